@@ -0,0 +1,116 @@
+package wayland
+
+// #include <wayland-client.h>
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// globalInterface describes a global interface that can be bound with Bind and
+// Registry.BindGlobal.
+type globalInterface struct {
+	iface *C.struct_wl_interface
+	// maxVersion is the highest version whose events the bindings handle. The version
+	// libwayland or the protocol's generated code supports may be higher.
+	maxVersion uint32
+	typ        reflect.Type
+	bind       func(reg *Registry, name, vers uint32) Proxy
+}
+
+// version returns the highest version of the interface that can be bound.
+func (gi globalInterface) version() uint32 {
+	return min(gi.maxVersion, uint32(gi.iface.version))
+}
+
+// interfaceTable maps the wire names of the supported global interfaces to their
+// descriptions.
+var interfaceTable = map[string]globalInterface{
+	"wl_compositor": {CompositorInterface, 6, reflect.TypeFor[*Compositor](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindCompositor(name, vers) }},
+	"wl_output": {OutputInterface, 4, reflect.TypeFor[*Output](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindOutput(name, vers) }},
+	// Version 2 requires destroying the object with the release request.
+	"wl_shm": {ShmInterface, 1, reflect.TypeFor[*Shm](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindShm(name, vers) }},
+	"wp_fractional_scale_manager_v1": {WpFractionalScaleManagerV1Interface, 1, reflect.TypeFor[*WpFractionalScaleManager](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindWpFractionalScaleManagerV1(name, vers) }},
+	"wp_presentation": {WpPresentationInterface, 1, reflect.TypeFor[*WpPresentation](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindWpPresentation(name, vers) }},
+	"wp_viewporter": {WpViewporterInterface, 1, reflect.TypeFor[*WpViewporter](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindWpViewporter(name, vers) }},
+	"xdg_wm_base": {XdgWmBaseInterface, 6, reflect.TypeFor[*XdgWmBase](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindXdgWmBase(name, vers) }},
+	"zwp_linux_dmabuf_v1": {ZwpLinuxDmabufV1Interface, 5, reflect.TypeFor[*LinuxDmabuf](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindZwpLinuxDmabufV1(name, vers) }},
+	"zxdg_decoration_manager_v1": {ZxdgDecorationManagerV1Interface, 1, reflect.TypeFor[*XdgDecorationManager](),
+		func(reg *Registry, name, vers uint32) Proxy { return reg.BindZxdgDecorationManagerV1(name, vers) }},
+}
+
+// interfaceNames maps the Go types of global interfaces to their wire names.
+var interfaceNames = map[reflect.Type]string{}
+
+// maxVersions maps global interfaces to the highest version that can be bound. The Bind*
+// methods use it to clamp versions.
+var maxVersions = map[*C.struct_wl_interface]uint32{}
+
+func init() {
+	for name, gi := range interfaceTable {
+		interfaceNames[gi.typ] = name
+		maxVersions[gi.iface] = gi.version()
+	}
+}
+
+// InterfaceVersion returns the highest version of the global interface iface, such as
+// "wl_output", that this package supports. It returns false if the interface can't be bound
+// with Bind or Registry.BindGlobal.
+func InterfaceVersion(iface string) (int, bool) {
+	gi, ok := interfaceTable[iface]
+	if !ok {
+		return 0, false
+	}
+	return int(gi.version()), true
+}
+
+// BindGlobal binds the global called name, which the server advertised as iface with the
+// given version, using the highest version supported by both sides. It is meant to be used in
+// OnGlobal; the returned value can be type-asserted to the interface's type, such as *Output.
+// It returns an error if the interface isn't supported.
+func (reg *Registry) BindGlobal(name uint32, iface string, version uint32) (Proxy, error) {
+	gi, ok := interfaceTable[iface]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interface %q", iface)
+	}
+	return gi.bind(reg, name, clampVersion(gi.iface, version)), nil
+}
+
+// Bind binds the global called name, whose interface must match T, such as *Compositor. The
+// bound version is the lowest of version, the version advertised by the server, and the
+// highest version supported by this package. As with NewGlobals, a version of 0 means no
+// limit beyond the latter two.
+//
+// The registry records the globals advertised by the server, so Bind can only be used for
+// globals that have been announced to reg and haven't been removed since.
+func Bind[T Proxy](reg *Registry, name uint32, version uint32) (T, error) {
+	var zero T
+	iface, ok := interfaceNames[reflect.TypeFor[T]()]
+	if !ok {
+		return zero, fmt.Errorf("%s isn't a global interface", reflect.TypeFor[T]())
+	}
+	adv, ok := reg.advertised[name]
+	if !ok {
+		return zero, fmt.Errorf("no global with name %d", name)
+	}
+	if adv.iface != iface {
+		return zero, fmt.Errorf("global %d is %s, not %s", name, adv.iface, iface)
+	}
+	if version == 0 {
+		version = adv.version
+	}
+	p, err := reg.BindGlobal(name, iface, min(version, adv.version))
+	if err != nil {
+		return zero, err
+	}
+	return p.(T), nil
+}
@@ -0,0 +1,129 @@
+package wayland
+
+import (
+	"slices"
+	"testing"
+)
+
+// testEvent is an event sent by TestBindMaxVersion.
+type testEvent struct {
+	name   string
+	since  int
+	opcode uint16
+	args   []any
+}
+
+// globalEvents lists all events of the supported global interfaces.
+var globalEvents = map[string][]testEvent{
+	"wl_compositor": nil,
+	"wl_output": {
+		{"geometry", 1, 0, []any{int32(0), int32(0), int32(300), int32(200), int32(0), "make", "model", int32(0)}},
+		{"mode", 1, 1, []any{uint32(3), int32(1920), int32(1080), int32(60000)}},
+		{"done", 2, 2, nil},
+		{"scale", 2, 3, []any{int32(2)}},
+		{"name", 4, 4, []any{"DP-1"}},
+		{"description", 4, 5, []any{"monitor"}},
+	},
+	"wl_shm":                         {{"format", 1, 0, []any{uint32(ShmFormatArgb8888)}}},
+	"wp_fractional_scale_manager_v1": nil,
+	"wp_presentation":                {{"clock_id", 1, 0, []any{uint32(1)}}},
+	"wp_viewporter":                  nil,
+	"xdg_wm_base":                    {{"ping", 1, 0, []any{uint32(1)}}},
+	"zwp_linux_dmabuf_v1": {
+		{"format", 1, 0, []any{uint32(ShmFormatArgb8888)}},
+		{"modifier", 3, 1, []any{uint32(ShmFormatArgb8888), uint32(0), uint32(0)}},
+	},
+	"zxdg_decoration_manager_v1": nil,
+}
+
+// toplevelEvents lists all events of xdg_toplevel, whose version is that of xdg_wm_base.
+var toplevelEvents = []testEvent{
+	{"configure", 1, 0, []any{int32(800), int32(600), indices(1, 0)}},
+	{"close", 1, 1, nil},
+	{"configure_bounds", 4, 2, []any{int32(1920), int32(1080)}},
+	{"wm_capabilities", 5, 3, []any{indices(1, 0)}},
+}
+
+// sendEvents sends the events that version supports to id and returns how many it sent.
+func sendEvents(s *testServer, id uint32, version int, events []testEvent) int {
+	var n int
+	for _, ev := range events {
+		if ev.since <= version {
+			s.send(id, ev.opcode, ev.args...)
+			n++
+		}
+	}
+	return n
+}
+
+func TestBindMaxVersion(t *testing.T) {
+	// Servers may advertise versions newer than what we support, and binding the highest
+	// version we claim to support mustn't let the server send events we can't handle.
+	for iface, gi := range interfaceTable {
+		t.Run(iface, func(t *testing.T) {
+			events, ok := globalEvents[iface]
+			if !ok {
+				t.Fatal("no events listed for interface")
+			}
+			s, dsp := newTestServer(t, nil, testGlobal{1, iface, 100})
+			reg := dsp.Registry()
+			roundtrip(t, dsp)
+			p, err := reg.BindGlobal(1, iface, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := InterfaceVersion(iface)
+			if p.Version() != want || want != int(gi.version()) {
+				t.Fatalf("bound version %d, InterfaceVersion returned %d", p.Version(), want)
+			}
+			dsp.BufferEvents(p)
+			n := sendEvents(s, p.ID(), p.Version(), events)
+			roundtrip(t, dsp)
+			if got := len(slices.Collect(dsp.Events())); got != n {
+				t.Errorf("got %d events, want %d", got, n)
+			}
+		})
+	}
+}
+
+func TestBindMaxVersionToplevel(t *testing.T) {
+	s, dsp := newTestServer(t, nil, testGlobal{1, "wl_compositor", 100}, testGlobal{2, "xdg_wm_base", 100})
+	reg := dsp.Registry()
+	roundtrip(t, dsp)
+	comp, err := Bind[*Compositor](reg, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xdg, err := Bind[*XdgWmBase](reg, 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := xdg.XdgSurface(comp.CreateSurface()).Toplevel()
+	var bounds, caps bool
+	top.OnConfigureBounds = func(width, height int32) { bounds = width == 1920 && height == 1080 }
+	top.OnWm_capabilities = func([]uint32) { caps = true }
+	dsp.BufferEvents(top)
+	n := sendEvents(s, top.ID(), top.Version(), toplevelEvents)
+	roundtrip(t, dsp)
+	if got := len(slices.Collect(dsp.Events())); got != n {
+		t.Errorf("got %d events, want %d", got, n)
+	}
+	if top.Version() >= 4 && !bounds {
+		t.Error("OnConfigureBounds wasn't called with the bounds")
+	}
+	if top.Version() >= 5 && !caps {
+		t.Error("OnWm_capabilities wasn't called")
+	}
+}
+
+func TestBindVersionZero(t *testing.T) {
+	_, dsp := newTestServer(t, nil, testGlobal{1, "wl_output", 3}, testGlobal{2, "xdg_wm_base", 100})
+	out := bindGlobal[*Output](t, dsp, 1, 0)
+	if out.Version() != 3 {
+		t.Errorf("bound wl_output version %d, want the advertised version 3", out.Version())
+	}
+	xdg := bindGlobal[*XdgWmBase](t, dsp, 2, 0)
+	if want, _ := InterfaceVersion("xdg_wm_base"); xdg.Version() != want {
+		t.Errorf("bound xdg_wm_base version %d, want the supported version %d", xdg.Version(), want)
+	}
+}
@@ -0,0 +1,808 @@
+package wayland
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Pixel conversion between ShmFormats.
+//
+// Renderers usually target a single internal format, but compositors are only required to
+// support ShmFormatArgb8888 and ShmFormatXrgb8888. ConvertPixels lets a client render into
+// whatever format suits it and ship whatever the server advertised via Shm.OnFormat.
+//
+// Conversions between two RGB formats go through a normalized float32 RGBA representation, with
+// fast paths for identical formats and for swizzling between the 32-bit 8-bit-per-channel
+// formats. YCbCr formats are converted to and from RGB using the matrix and range selected
+// in ConvertOptions; conversions from 8-bit YCbCr to 32-bit RGB use fixed-point arithmetic.
+
+var ErrUnsupportedFormat = errors.New("unsupported pixel format")
+
+// YCbCrMatrix selects the coefficients used to convert between RGB and YCbCr.
+type YCbCrMatrix int
+
+const (
+	BT601 YCbCrMatrix = iota
+	BT709
+	BT2020
+)
+
+func (m YCbCrMatrix) String() string {
+	switch m {
+	case BT601:
+		return "BT.601"
+	case BT709:
+		return "BT.709"
+	case BT2020:
+		return "BT.2020"
+	default:
+		return fmt.Sprintf("YCbCrMatrix(%d)", int(m))
+	}
+}
+
+type ConvertOptions struct {
+	Matrix YCbCrMatrix
+	// FullRange selects full-range YCbCr (0–255) instead of limited range (16–235 for luma,
+	// 16–240 for chroma).
+	FullRange bool
+}
+
+// Pixels describes an image stored in one of the ShmFormats. Packed formats only use the first
+// plane. Multi-planar formats store luma in the first plane and chroma in the following ones,
+// in the order defined by the format.
+type Pixels struct {
+	Format        ShmFormat
+	Width, Height int
+	Planes        [3][]byte
+	Strides       [3]int
+}
+
+// ConvertPixels converts src into dst, which must have the same dimensions. opts may be nil,
+// in which case limited-range BT.601 is used.
+func ConvertPixels(dst, src *Pixels, opts *ConvertOptions) error {
+	if dst.Width != src.Width || dst.Height != src.Height {
+		return fmt.Errorf("mismatched image sizes %dx%d and %dx%d", dst.Width, dst.Height, src.Width, src.Height)
+	}
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	sl, ok := lookupPixelLayout(src.Format)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, src.Format)
+	}
+	dl, ok := lookupPixelLayout(dst.Format)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, dst.Format)
+	}
+	if err := sl.validate(src); err != nil {
+		return fmt.Errorf("source image: %w", err)
+	}
+	if err := dl.validate(dst); err != nil {
+		return fmt.Errorf("destination image: %w", err)
+	}
+	if src.Width == 0 || src.Height == 0 {
+		return nil
+	}
+	mat := newYCbCrCoeffs(opts.Matrix, opts.FullRange)
+
+	switch {
+	case src.Format == dst.Format:
+		copyPixels(dst, src, sl)
+	case sl.rgb != nil && dl.rgb != nil && sl.rgb.is8888() && dl.rgb.is8888():
+		swizzle8888(dst, src, dl.rgb, sl.rgb)
+	case sl.yuv != nil && dl.rgb != nil && dl.rgb.is8888():
+		convertYUVToRGB8888(dst, src, sl.yuv, dl.rgb, mat)
+	default:
+		convertGeneric(dst, src, dl, sl, mat)
+	}
+	return nil
+}
+
+// pixelLayout describes the memory layout of a ShmFormat. Exactly one of rgb and yuv is set.
+type pixelLayout struct {
+	rgb *rgbLayout
+	yuv *yuvLayout
+}
+
+func (l pixelLayout) validate(p *Pixels) error {
+	if p.Width < 0 || p.Height < 0 {
+		return fmt.Errorf("invalid size %dx%d", p.Width, p.Height)
+	}
+	if p.Width == 0 || p.Height == 0 {
+		return nil
+	}
+	check := func(plane int, rowBytes, rows int) error {
+		if p.Strides[plane] < rowBytes {
+			return fmt.Errorf("stride %d of plane %d too small, need at least %d", p.Strides[plane], plane, rowBytes)
+		}
+		if need := p.Strides[plane]*(rows-1) + rowBytes; len(p.Planes[plane]) < need {
+			return fmt.Errorf("plane %d too short: have %d bytes, need %d", plane, len(p.Planes[plane]), need)
+		}
+		return nil
+	}
+	if l.rgb != nil {
+		return check(0, p.Width*l.rgb.bytes, p.Height)
+	}
+	y := l.yuv
+	cw, ch := ceilDiv(p.Width, y.hsub), ceilDiv(p.Height, y.vsub)
+	switch y.kind {
+	case yuvPacked:
+		return check(0, ceilDiv(p.Width, y.ppu)*y.unit, p.Height)
+	case yuvSemiPlanar:
+		if err := check(0, p.Width, p.Height); err != nil {
+			return err
+		}
+		return check(1, cw*2, ch)
+	case yuvPlanar:
+		if err := check(0, p.Width, p.Height); err != nil {
+			return err
+		}
+		if err := check(1, cw, ch); err != nil {
+			return err
+		}
+		return check(2, cw, ch)
+	default:
+		panic("unreachable")
+	}
+}
+
+// rgbLayout describes a packed RGB format whose pixels are little-endian integers of 1 to 8
+// bytes, with each channel occupying a contiguous bit field.
+type rgbLayout struct {
+	bytes int
+	// r, g, b, a. a.bits is zero for formats without alpha.
+	ch [4]rgbChannel
+	// pad is ORed into every encoded pixel of formats with an x channel. It sets the unused
+	// bits to ones, or to 1.0 for half-float formats, where all ones would be a NaN.
+	pad   uint64
+	float bool
+}
+
+type rgbChannel struct {
+	shift uint8
+	bits  uint8
+}
+
+func (c rgbChannel) mask() uint64 { return 1<<c.bits - 1 }
+
+// rgbFormat builds an rgbLayout from the channel order used in the ShmFormat documentation,
+// which lists channels from the most to the least significant bits. 'X' denotes padding.
+func rgbFormat(order string, bits ...uint8) *rgbLayout {
+	if len(order) != len(bits) {
+		panic("mismatched channel description")
+	}
+	l := &rgbLayout{}
+	var shift uint8
+	for i := len(order) - 1; i >= 0; i-- {
+		c := rgbChannel{shift: shift, bits: bits[i]}
+		switch order[i] {
+		case 'R':
+			l.ch[0] = c
+		case 'G':
+			l.ch[1] = c
+		case 'B':
+			l.ch[2] = c
+		case 'A':
+			l.ch[3] = c
+		case 'X':
+			l.pad |= c.mask() << c.shift
+		default:
+			panic(fmt.Sprintf("invalid channel %q", order[i]))
+		}
+		shift += bits[i]
+	}
+	l.bytes = int(shift) / 8
+	return l
+}
+
+func rgbFloatFormat(order string) *rgbLayout {
+	l := rgbFormat(order, 16, 16, 16, 16)
+	l.float = true
+	for shift := 0; shift < 64; shift += 16 {
+		if l.pad>>shift&0xffff != 0 {
+			l.pad = l.pad&^(0xffff<<shift) | 0x3c00<<shift
+		}
+	}
+	return l
+}
+
+// is8888 reports whether the layout uses 32-bit pixels with 8 bits per channel at byte
+// boundaries.
+func (l *rgbLayout) is8888() bool {
+	if l.bytes != 4 || l.float {
+		return false
+	}
+	for _, c := range l.ch[:3] {
+		if c.bits != 8 {
+			return false
+		}
+	}
+	return l.ch[3].bits == 8 || l.ch[3].bits == 0
+}
+
+// byteIndex returns the byte of a 32-bit pixel that holds channel c, or -1 if the channel is
+// absent.
+func (l *rgbLayout) byteIndex(c int) int {
+	if l.ch[c].bits == 0 {
+		return -1
+	}
+	return int(l.ch[c].shift) / 8
+}
+
+func (l *rgbLayout) load(b []byte) uint64 {
+	var v uint64
+	for i := l.bytes - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func (l *rgbLayout) store(b []byte, v uint64) {
+	for i := 0; i < l.bytes; i++ {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+func (l *rgbLayout) decodeRow(out []float32, row []byte, width int) {
+	for x := 0; x < width; x++ {
+		px := l.load(row[x*l.bytes:])
+		o := out[x*4 : x*4+4]
+		for i, c := range l.ch {
+			switch {
+			case c.bits == 0:
+				o[i] = 1
+			case l.float:
+				o[i] = halfToFloat(uint16(px >> c.shift))
+			default:
+				o[i] = float32(px>>c.shift&c.mask()) / float32(c.mask())
+			}
+		}
+	}
+}
+
+func (l *rgbLayout) encodeRow(row []byte, in []float32, width int) {
+	for x := 0; x < width; x++ {
+		px := l.pad
+		v := in[x*4 : x*4+4]
+		for i, c := range l.ch {
+			if c.bits == 0 {
+				continue
+			}
+			if l.float {
+				px |= uint64(floatToHalf(v[i])) << c.shift
+			} else {
+				px |= uint64(unorm(v[i], c.mask())) << c.shift
+			}
+		}
+		l.store(row[x*l.bytes:], px)
+	}
+}
+
+type yuvKind int
+
+const (
+	// yuvPacked stores all components of one or two pixels in a single unit.
+	yuvPacked yuvKind = iota
+	// yuvSemiPlanar stores luma in one plane and interleaved chroma in a second one.
+	yuvSemiPlanar
+	// yuvPlanar stores luma and each chroma component in separate planes.
+	yuvPlanar
+)
+
+type yuvLayout struct {
+	kind       yuvKind
+	hsub, vsub int
+	// swapUV is set for semi-planar and planar formats that store Cr before Cb.
+	swapUV bool
+
+	// Packed formats only. unit is the size in bytes of a group of ppu pixels. y holds the
+	// luma offset of each pixel in the group; u, v and a are offsets of the shared chroma and
+	// alpha samples, with a being -1 for formats without alpha.
+	unit, ppu int
+	y         [2]int
+	u, v, a   int
+}
+
+// loadRow reads the samples of row y, upsampling chroma by nearest neighbour. Alpha is set to
+// 255 for formats without alpha.
+func (l *yuvLayout) loadRow(p *Pixels, y int, ys, us, vs, as []uint8) {
+	switch l.kind {
+	case yuvPacked:
+		row := p.Planes[0][y*p.Strides[0]:]
+		for x := 0; x < p.Width; x++ {
+			unit := row[x/l.ppu*l.unit:]
+			ys[x] = unit[l.y[x%l.ppu]]
+			us[x] = unit[l.u]
+			vs[x] = unit[l.v]
+			if l.a >= 0 {
+				as[x] = unit[l.a]
+			} else {
+				as[x] = 255
+			}
+		}
+	case yuvSemiPlanar:
+		copy(ys, p.Planes[0][y*p.Strides[0]:][:p.Width])
+		crow := p.Planes[1][y/l.vsub*p.Strides[1]:]
+		ui, vi := 0, 1
+		if l.swapUV {
+			ui, vi = 1, 0
+		}
+		for x := 0; x < p.Width; x++ {
+			c := x / l.hsub * 2
+			us[x] = crow[c+ui]
+			vs[x] = crow[c+vi]
+			as[x] = 255
+		}
+	case yuvPlanar:
+		copy(ys, p.Planes[0][y*p.Strides[0]:][:p.Width])
+		up, vp := 1, 2
+		if l.swapUV {
+			up, vp = 2, 1
+		}
+		urow := p.Planes[up][y/l.vsub*p.Strides[up]:]
+		vrow := p.Planes[vp][y/l.vsub*p.Strides[vp]:]
+		for x := 0; x < p.Width; x++ {
+			us[x] = urow[x/l.hsub]
+			vs[x] = vrow[x/l.hsub]
+			as[x] = 255
+		}
+	}
+}
+
+// storeBlock encodes the rows starting at y0, which must cover one block of vsub rows or the
+// remaining rows of the image. Chroma is computed by averaging each hsub×vsub block.
+func (l *yuvLayout) storeBlock(p *Pixels, y0 int, rows [][]float32, m *ycbcrCoeffs) {
+	for i, rgba := range rows {
+		if l.kind == yuvPacked {
+			row := p.Planes[0][(y0+i)*p.Strides[0]:]
+			for x := 0; x < p.Width; x += l.ppu {
+				unit := row[x/l.ppu*l.unit:]
+				n := min(l.ppu, p.Width-x)
+				var su, sv, sa float32
+				for j := 0; j < n; j++ {
+					px := rgba[(x+j)*4:]
+					yy, u, v := m.fromRGB(px[0], px[1], px[2])
+					unit[l.y[j]] = yy
+					su += u
+					sv += v
+					sa += px[3]
+				}
+				if n < l.ppu {
+					// Odd width; duplicate the last pixel.
+					unit[l.y[1]] = unit[l.y[0]]
+				}
+				unit[l.u] = m.chroma(su / float32(n))
+				unit[l.v] = m.chroma(sv / float32(n))
+				if l.a >= 0 {
+					unit[l.a] = uint8(unorm(sa/float32(n), 255))
+				}
+			}
+			continue
+		}
+		row := p.Planes[0][(y0+i)*p.Strides[0]:]
+		for x := 0; x < p.Width; x++ {
+			px := rgba[x*4:]
+			row[x], _, _ = m.fromRGB(px[0], px[1], px[2])
+		}
+	}
+	if l.kind == yuvPacked {
+		return
+	}
+
+	cy := y0 / l.vsub
+	for cx := 0; cx < ceilDiv(p.Width, l.hsub); cx++ {
+		var su, sv float32
+		var n int
+		for _, rgba := range rows {
+			for x := cx * l.hsub; x < min((cx+1)*l.hsub, p.Width); x++ {
+				px := rgba[x*4:]
+				_, u, v := m.fromRGB(px[0], px[1], px[2])
+				su += u
+				sv += v
+				n++
+			}
+		}
+		u, v := m.chroma(su/float32(n)), m.chroma(sv/float32(n))
+		if l.swapUV {
+			u, v = v, u
+		}
+		if l.kind == yuvSemiPlanar {
+			crow := p.Planes[1][cy*p.Strides[1]:]
+			crow[cx*2] = u
+			crow[cx*2+1] = v
+		} else {
+			p.Planes[1][cy*p.Strides[1]+cx] = u
+			p.Planes[2][cy*p.Strides[2]+cx] = v
+		}
+	}
+}
+
+func packedYUV(unit, ppu int, y [2]int, u, v, a int) *yuvLayout {
+	return &yuvLayout{kind: yuvPacked, hsub: ppu, vsub: 1, unit: unit, ppu: ppu, y: y, u: u, v: v, a: a}
+}
+
+func semiPlanarYUV(hsub, vsub int, swapUV bool) *yuvLayout {
+	return &yuvLayout{kind: yuvSemiPlanar, hsub: hsub, vsub: vsub, swapUV: swapUV}
+}
+
+func planarYUV(hsub, vsub int, swapUV bool) *yuvLayout {
+	return &yuvLayout{kind: yuvPlanar, hsub: hsub, vsub: vsub, swapUV: swapUV}
+}
+
+var pixelLayouts = map[ShmFormat]pixelLayout{
+	ShmFormatArgb8888: {rgb: rgbFormat("ARGB", 8, 8, 8, 8)},
+	ShmFormatXrgb8888: {rgb: rgbFormat("XRGB", 8, 8, 8, 8)},
+	ShmFormatAbgr8888: {rgb: rgbFormat("ABGR", 8, 8, 8, 8)},
+	ShmFormatXbgr8888: {rgb: rgbFormat("XBGR", 8, 8, 8, 8)},
+	ShmFormatRgba8888: {rgb: rgbFormat("RGBA", 8, 8, 8, 8)},
+	ShmFormatRgbx8888: {rgb: rgbFormat("RGBX", 8, 8, 8, 8)},
+	ShmFormatBgra8888: {rgb: rgbFormat("BGRA", 8, 8, 8, 8)},
+	ShmFormatBgrx8888: {rgb: rgbFormat("BGRX", 8, 8, 8, 8)},
+
+	ShmFormatRgb888: {rgb: rgbFormat("RGB", 8, 8, 8)},
+	ShmFormatBgr888: {rgb: rgbFormat("BGR", 8, 8, 8)},
+	ShmFormatRgb332: {rgb: rgbFormat("RGB", 3, 3, 2)},
+	ShmFormatBgr233: {rgb: rgbFormat("BGR", 2, 3, 3)},
+	ShmFormatRgb565: {rgb: rgbFormat("RGB", 5, 6, 5)},
+	ShmFormatBgr565: {rgb: rgbFormat("BGR", 5, 6, 5)},
+
+	ShmFormatXrgb4444: {rgb: rgbFormat("XRGB", 4, 4, 4, 4)},
+	ShmFormatXbgr4444: {rgb: rgbFormat("XBGR", 4, 4, 4, 4)},
+	ShmFormatRgbx4444: {rgb: rgbFormat("RGBX", 4, 4, 4, 4)},
+	ShmFormatBgrx4444: {rgb: rgbFormat("BGRX", 4, 4, 4, 4)},
+	ShmFormatArgb4444: {rgb: rgbFormat("ARGB", 4, 4, 4, 4)},
+	ShmFormatAbgr4444: {rgb: rgbFormat("ABGR", 4, 4, 4, 4)},
+	ShmFormatRgba4444: {rgb: rgbFormat("RGBA", 4, 4, 4, 4)},
+	ShmFormatBgra4444: {rgb: rgbFormat("BGRA", 4, 4, 4, 4)},
+
+	ShmFormatXrgb1555: {rgb: rgbFormat("XRGB", 1, 5, 5, 5)},
+	ShmFormatXbgr1555: {rgb: rgbFormat("XBGR", 1, 5, 5, 5)},
+	ShmFormatRgbx5551: {rgb: rgbFormat("RGBX", 5, 5, 5, 1)},
+	ShmFormatBgrx5551: {rgb: rgbFormat("BGRX", 5, 5, 5, 1)},
+	ShmFormatArgb1555: {rgb: rgbFormat("ARGB", 1, 5, 5, 5)},
+	ShmFormatAbgr1555: {rgb: rgbFormat("ABGR", 1, 5, 5, 5)},
+	ShmFormatRgba5551: {rgb: rgbFormat("RGBA", 5, 5, 5, 1)},
+	ShmFormatBgra5551: {rgb: rgbFormat("BGRA", 5, 5, 5, 1)},
+
+	ShmFormatXrgb2101010: {rgb: rgbFormat("XRGB", 2, 10, 10, 10)},
+	ShmFormatXbgr2101010: {rgb: rgbFormat("XBGR", 2, 10, 10, 10)},
+	ShmFormatRgbx1010102: {rgb: rgbFormat("RGBX", 10, 10, 10, 2)},
+	ShmFormatBgrx1010102: {rgb: rgbFormat("BGRX", 10, 10, 10, 2)},
+	ShmFormatArgb2101010: {rgb: rgbFormat("ARGB", 2, 10, 10, 10)},
+	ShmFormatAbgr2101010: {rgb: rgbFormat("ABGR", 2, 10, 10, 10)},
+	ShmFormatRgba1010102: {rgb: rgbFormat("RGBA", 10, 10, 10, 2)},
+	ShmFormatBgra1010102: {rgb: rgbFormat("BGRA", 10, 10, 10, 2)},
+
+	ShmFormatXrgb16161616: {rgb: rgbFormat("XRGB", 16, 16, 16, 16)},
+	ShmFormatXbgr16161616: {rgb: rgbFormat("XBGR", 16, 16, 16, 16)},
+	ShmFormatArgb16161616: {rgb: rgbFormat("ARGB", 16, 16, 16, 16)},
+	ShmFormatAbgr16161616: {rgb: rgbFormat("ABGR", 16, 16, 16, 16)},
+
+	ShmFormatXrgb16161616f: {rgb: rgbFloatFormat("XRGB")},
+	ShmFormatXbgr16161616f: {rgb: rgbFloatFormat("XBGR")},
+	ShmFormatArgb16161616f: {rgb: rgbFloatFormat("ARGB")},
+	ShmFormatAbgr16161616f: {rgb: rgbFloatFormat("ABGR")},
+
+	ShmFormatYuyv:     {yuv: packedYUV(4, 2, [2]int{0, 2}, 1, 3, -1)},
+	ShmFormatYvyu:     {yuv: packedYUV(4, 2, [2]int{0, 2}, 3, 1, -1)},
+	ShmFormatUyvy:     {yuv: packedYUV(4, 2, [2]int{1, 3}, 0, 2, -1)},
+	ShmFormatVyuy:     {yuv: packedYUV(4, 2, [2]int{1, 3}, 2, 0, -1)},
+	ShmFormatAyuv:     {yuv: packedYUV(4, 1, [2]int{2}, 1, 0, 3)},
+	ShmFormatXyuv8888: {yuv: packedYUV(4, 1, [2]int{2}, 1, 0, -1)},
+	ShmFormatVuy888:   {yuv: packedYUV(3, 1, [2]int{0}, 1, 2, -1)},
+
+	ShmFormatNv12: {yuv: semiPlanarYUV(2, 2, false)},
+	ShmFormatNv21: {yuv: semiPlanarYUV(2, 2, true)},
+	ShmFormatNv16: {yuv: semiPlanarYUV(2, 1, false)},
+	ShmFormatNv61: {yuv: semiPlanarYUV(2, 1, true)},
+	ShmFormatNv24: {yuv: semiPlanarYUV(1, 1, false)},
+	ShmFormatNv42: {yuv: semiPlanarYUV(1, 1, true)},
+
+	ShmFormatYuv410: {yuv: planarYUV(4, 4, false)},
+	ShmFormatYvu410: {yuv: planarYUV(4, 4, true)},
+	ShmFormatYuv411: {yuv: planarYUV(4, 1, false)},
+	ShmFormatYvu411: {yuv: planarYUV(4, 1, true)},
+	ShmFormatYuv420: {yuv: planarYUV(2, 2, false)},
+	ShmFormatYvu420: {yuv: planarYUV(2, 2, true)},
+	ShmFormatYuv422: {yuv: planarYUV(2, 1, false)},
+	ShmFormatYvu422: {yuv: planarYUV(2, 1, true)},
+	ShmFormatYuv444: {yuv: planarYUV(1, 1, false)},
+	ShmFormatYvu444: {yuv: planarYUV(1, 1, true)},
+}
+
+func lookupPixelLayout(f ShmFormat) (pixelLayout, bool) {
+	l, ok := pixelLayouts[f]
+	return l, ok
+}
+
+// CanConvert reports whether ConvertPixels supports f as a source and destination format.
+func CanConvert(f ShmFormat) bool {
+	_, ok := pixelLayouts[f]
+	return ok
+}
+
+func copyPixels(dst, src *Pixels, l pixelLayout) {
+	plane := func(i, rowBytes, rows int) {
+		for y := 0; y < rows; y++ {
+			copy(dst.Planes[i][y*dst.Strides[i]:][:rowBytes], src.Planes[i][y*src.Strides[i]:])
+		}
+	}
+	if l.rgb != nil {
+		plane(0, src.Width*l.rgb.bytes, src.Height)
+		return
+	}
+	y := l.yuv
+	cw, ch := ceilDiv(src.Width, y.hsub), ceilDiv(src.Height, y.vsub)
+	switch y.kind {
+	case yuvPacked:
+		plane(0, ceilDiv(src.Width, y.ppu)*y.unit, src.Height)
+	case yuvSemiPlanar:
+		plane(0, src.Width, src.Height)
+		plane(1, cw*2, ch)
+	case yuvPlanar:
+		plane(0, src.Width, src.Height)
+		plane(1, cw, ch)
+		plane(2, cw, ch)
+	}
+}
+
+// swizzle8888 converts between two 32-bit formats with 8 bits per channel by permuting bytes.
+func swizzle8888(dst, src *Pixels, dl, sl *rgbLayout) {
+	// perm[i] is the source byte for destination byte i, or -1 to write 0xff.
+	var perm [4]int
+	for i := range perm {
+		perm[i] = -1
+	}
+	for c := 0; c < 4; c++ {
+		if d := dl.byteIndex(c); d >= 0 {
+			perm[d] = sl.byteIndex(c)
+		}
+	}
+	for y := 0; y < src.Height; y++ {
+		srow := src.Planes[0][y*src.Strides[0]:][:src.Width*4]
+		drow := dst.Planes[0][y*dst.Strides[0]:][:src.Width*4]
+		for x := 0; x < len(srow); x += 4 {
+			s := srow[x : x+4 : x+4]
+			d := drow[x : x+4 : x+4]
+			for i, p := range perm {
+				if p < 0 {
+					d[i] = 0xff
+				} else {
+					d[i] = s[p]
+				}
+			}
+		}
+	}
+}
+
+// convertYUVToRGB8888 converts 8-bit YCbCr to a 32-bit RGB format using fixed-point math.
+func convertYUVToRGB8888(dst, src *Pixels, sl *yuvLayout, dl *rgbLayout, m *ycbcrCoeffs) {
+	ys := make([]uint8, src.Width)
+	us := make([]uint8, src.Width)
+	vs := make([]uint8, src.Width)
+	as := make([]uint8, src.Width)
+	ri, gi, bi, ai := dl.byteIndex(0), dl.byteIndex(1), dl.byteIndex(2), dl.byteIndex(3)
+	if ai < 0 {
+		// Padding byte.
+		ai = 6 - ri - gi - bi
+	}
+	for y := 0; y < src.Height; y++ {
+		sl.loadRow(src, y, ys, us, vs, as)
+		drow := dst.Planes[0][y*dst.Strides[0]:][:src.Width*4]
+		for x := 0; x < src.Width; x++ {
+			r, g, b := m.toRGB8(ys[x], us[x], vs[x])
+			d := drow[x*4 : x*4+4 : x*4+4]
+			d[ri] = r
+			d[gi] = g
+			d[bi] = b
+			if dl.ch[3].bits == 0 {
+				d[ai] = 0xff
+			} else {
+				d[ai] = as[x]
+			}
+		}
+	}
+}
+
+func convertGeneric(dst, src *Pixels, dl, sl pixelLayout, m *ycbcrCoeffs) {
+	block := 1
+	if dl.yuv != nil {
+		block = dl.yuv.vsub
+	}
+	rows := make([][]float32, block)
+	for i := range rows {
+		rows[i] = make([]float32, src.Width*4)
+	}
+	var ys, us, vs, as []uint8
+	if sl.yuv != nil {
+		ys = make([]uint8, src.Width)
+		us = make([]uint8, src.Width)
+		vs = make([]uint8, src.Width)
+		as = make([]uint8, src.Width)
+	}
+
+	for y0 := 0; y0 < src.Height; y0 += block {
+		n := min(block, src.Height-y0)
+		for i := 0; i < n; i++ {
+			y := y0 + i
+			out := rows[i]
+			if sl.rgb != nil {
+				sl.rgb.decodeRow(out, src.Planes[0][y*src.Strides[0]:], src.Width)
+				continue
+			}
+			sl.yuv.loadRow(src, y, ys, us, vs, as)
+			for x := 0; x < src.Width; x++ {
+				o := out[x*4 : x*4+4]
+				o[0], o[1], o[2] = m.toRGB(ys[x], us[x], vs[x])
+				o[3] = float32(as[x]) / 255
+			}
+		}
+		if dl.rgb != nil {
+			for i := 0; i < n; i++ {
+				dl.rgb.encodeRow(dst.Planes[0][(y0+i)*dst.Strides[0]:], rows[i], src.Width)
+			}
+		} else {
+			dl.yuv.storeBlock(dst, y0, rows[:n], m)
+		}
+	}
+}
+
+// ycbcrCoeffs holds the derived coefficients of a YCbCrMatrix for one quantization range.
+type ycbcrCoeffs struct {
+	kr, kg, kb float32
+	// Offsets and scales for 8-bit luma and chroma.
+	yOff, yScale, cScale float32
+	// Fixed-point (16.16) coefficients for toRGB8.
+	fy, frv, fgu, fgv, fbu int32
+	fyOff                  int32
+}
+
+func newYCbCrCoeffs(mat YCbCrMatrix, full bool) *ycbcrCoeffs {
+	var kr, kb float32
+	switch mat {
+	case BT709:
+		kr, kb = 0.2126, 0.0722
+	case BT2020:
+		kr, kb = 0.2627, 0.0593
+	default:
+		kr, kb = 0.299, 0.114
+	}
+	m := &ycbcrCoeffs{kr: kr, kg: 1 - kr - kb, kb: kb}
+	if full {
+		m.yOff, m.yScale, m.cScale = 0, 255, 255
+	} else {
+		m.yOff, m.yScale, m.cScale = 16, 219, 224
+	}
+	fix := func(f float32) int32 { return int32(math.Round(float64(f * 65536))) }
+	m.fyOff = int32(m.yOff)
+	m.fy = fix(255 / m.yScale)
+	m.frv = fix(2 * (1 - kr) * 255 / m.cScale)
+	m.fbu = fix(2 * (1 - kb) * 255 / m.cScale)
+	m.fgu = fix(2 * (1 - kb) * kb / m.kg * 255 / m.cScale)
+	m.fgv = fix(2 * (1 - kr) * kr / m.kg * 255 / m.cScale)
+	return m
+}
+
+// toRGB converts 8-bit YCbCr to normalized RGB.
+func (m *ycbcrCoeffs) toRGB(y, u, v uint8) (r, g, b float32) {
+	yy := (float32(y) - m.yOff) / m.yScale
+	cb := (float32(u) - 128) / m.cScale
+	cr := (float32(v) - 128) / m.cScale
+	r = yy + 2*(1-m.kr)*cr
+	b = yy + 2*(1-m.kb)*cb
+	g = (yy - m.kr*r - m.kb*b) / m.kg
+	return clamp01(r), clamp01(g), clamp01(b)
+}
+
+// toRGB8 is the fixed-point equivalent of toRGB, producing 8-bit channels.
+func (m *ycbcrCoeffs) toRGB8(y, u, v uint8) (r, g, b uint8) {
+	yy := (int32(y) - m.fyOff) * m.fy
+	cb := int32(u) - 128
+	cr := int32(v) - 128
+	const half = 1 << 15
+	return clamp8((yy + m.frv*cr + half) >> 16),
+		clamp8((yy - m.fgu*cb - m.fgv*cr + half) >> 16),
+		clamp8((yy + m.fbu*cb + half) >> 16)
+}
+
+// fromRGB converts normalized RGB to 8-bit luma and unquantized chroma in [-0.5, 0.5]. Chroma
+// is quantized separately by chroma so that it can be averaged first.
+func (m *ycbcrCoeffs) fromRGB(r, g, b float32) (y uint8, cb, cr float32) {
+	r, g, b = clamp01(r), clamp01(g), clamp01(b)
+	yy := m.kr*r + m.kg*g + m.kb*b
+	cb = (b - yy) / (2 * (1 - m.kb))
+	cr = (r - yy) / (2 * (1 - m.kr))
+	return clamp8(int32(math.Round(float64(m.yOff + yy*m.yScale)))), cb, cr
+}
+
+func (m *ycbcrCoeffs) chroma(c float32) uint8 {
+	return clamp8(int32(math.Round(float64(128 + c*m.cScale))))
+}
+
+func clamp01(f float32) float32 {
+	// Also maps NaN to 0.
+	if !(f > 0) {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+func clamp8(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+func unorm(f float32, max uint64) uint64 {
+	return uint64(math.Round(float64(clamp01(f)) * float64(max)))
+}
+
+func ceilDiv(a, b int) int { return (a + b - 1) / b }
+
+// halfToFloat converts an IEEE 754 binary16 value to float32.
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+	switch {
+	case exp == 0x1f:
+		// Inf and NaN
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal; renormalize.
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		exp++
+		mant &= 0x3ff
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// floatToHalf converts a float32 to IEEE 754 binary16, rounding to nearest even.
+func floatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		// Subnormal
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		h := mant >> shift
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && h&1 != 0) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	h := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && h&1 != 0) {
+		// May carry into the exponent, which correctly rounds up to the next power of two or
+		// to infinity.
+		h++
+	}
+	return sign | uint16(h)
+}
@@ -0,0 +1,360 @@
+package wayland
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+// newTestPixels allocates an image in format f. Rows are padded so that strides differ from
+// the row sizes.
+func newTestPixels(t *testing.T, f ShmFormat, w, h int) *Pixels {
+	t.Helper()
+	l, ok := lookupPixelLayout(f)
+	if !ok {
+		t.Fatalf("no layout for %s", f)
+	}
+	p := &Pixels{Format: f, Width: w, Height: h}
+	plane := func(i, rowBytes, rows int) {
+		p.Strides[i] = rowBytes + 3
+		p.Planes[i] = make([]byte, p.Strides[i]*rows)
+	}
+	if l.rgb != nil {
+		plane(0, w*l.rgb.bytes, h)
+		return p
+	}
+	y := l.yuv
+	cw, ch := ceilDiv(w, y.hsub), ceilDiv(h, y.vsub)
+	switch y.kind {
+	case yuvPacked:
+		plane(0, ceilDiv(w, y.ppu)*y.unit, h)
+	case yuvSemiPlanar:
+		plane(0, w, h)
+		plane(1, cw*2, ch)
+	case yuvPlanar:
+		plane(0, w, h)
+		plane(1, cw, ch)
+		plane(2, cw, ch)
+	}
+	return p
+}
+
+func formatsOf(rgb bool) []ShmFormat {
+	var out []ShmFormat
+	for f, l := range pixelLayouts {
+		if (l.rgb != nil) == rgb {
+			out = append(out, f)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// precision returns the largest quantization error of a channel of the layout.
+func (l *rgbLayout) precision(c int) float32 {
+	switch {
+	case l.ch[c].bits == 0:
+		return 0
+	case l.float:
+		// Values in [0, 1] have at least 11 bits of precision.
+		return 1.0 / 2048
+	default:
+		return 0.5 / float32(l.ch[c].mask())
+	}
+}
+
+var testColors = [][4]float32{
+	{0, 0, 0, 1},
+	{1, 1, 1, 1},
+	{1, 0, 0, 1},
+	{0, 1, 0, 0},
+	{0, 0, 1, 1},
+	{0.5, 0.25, 0.75, 1},
+	{0.2, 0.6, 0.4, 0},
+}
+
+func TestConvertRGB(t *testing.T) {
+	formats := formatsOf(true)
+	const w, h = 3, 2
+	for _, sf := range formats {
+		for _, df := range formats {
+			t.Run(fmt.Sprintf("%s/%s", sf, df), func(t *testing.T) {
+				sl, dl := pixelLayouts[sf].rgb, pixelLayouts[df].rgb
+				src := newTestPixels(t, sf, w, h)
+				dst := newTestPixels(t, df, w, h)
+				in := make([]float32, w*4)
+				for y := 0; y < h; y++ {
+					for x := 0; x < w; x++ {
+						copy(in[x*4:], testColors[(y*w+x)%len(testColors)][:])
+					}
+					sl.encodeRow(src.Planes[0][y*src.Strides[0]:], in, w)
+				}
+
+				if err := ConvertPixels(dst, src, nil); err != nil {
+					t.Fatal(err)
+				}
+
+				out := make([]float32, w*4)
+				for y := 0; y < h; y++ {
+					row := dst.Planes[0][y*dst.Strides[0]:]
+					dl.decodeRow(out, row, w)
+					for x := 0; x < w; x++ {
+						want := testColors[(y*w+x)%len(testColors)]
+						if sl.ch[3].bits == 0 || dl.ch[3].bits == 0 {
+							want[3] = 1
+						}
+						for c := 0; c < 4; c++ {
+							tol := sl.precision(c) + dl.precision(c) + 1e-6
+							if got := out[x*4+c]; math.Abs(float64(got-want[c])) > float64(tol) {
+								t.Errorf("pixel (%d, %d) channel %d: got %g, want %g±%g", x, y, c, got, want[c], tol)
+							}
+						}
+						if px := dl.load(row[x*dl.bytes:]); px&dl.pad != dl.pad {
+							t.Errorf("pixel (%d, %d): padding of %#x isn't %#x", x, y, px, dl.pad)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFloatPadding(t *testing.T) {
+	for _, f := range []ShmFormat{ShmFormatXrgb16161616f, ShmFormatXbgr16161616f} {
+		l := pixelLayouts[f].rgb
+		src := newTestPixels(t, ShmFormatArgb8888, 1, 1)
+		dst := newTestPixels(t, f, 1, 1)
+		copy(src.Planes[0], []byte{0x10, 0x20, 0x30, 0x40})
+		if err := ConvertPixels(dst, src, nil); err != nil {
+			t.Fatal(err)
+		}
+		// The X channel occupies the most significant 16 bits.
+		if x := halfToFloat(uint16(l.load(dst.Planes[0]) >> 48)); x != 1 {
+			t.Errorf("%s: X channel is %g, want 1", f, x)
+		}
+	}
+}
+
+func TestSwizzle8888(t *testing.T) {
+	src := newTestPixels(t, ShmFormatArgb8888, 1, 1)
+	// Little-endian ARGB stores B, G, R, A.
+	copy(src.Planes[0], []byte{0x11, 0x22, 0x33, 0x44})
+	tests := []struct {
+		f    ShmFormat
+		want []byte
+	}{
+		{ShmFormatArgb8888, []byte{0x11, 0x22, 0x33, 0x44}},
+		{ShmFormatXrgb8888, []byte{0x11, 0x22, 0x33, 0xff}},
+		{ShmFormatAbgr8888, []byte{0x33, 0x22, 0x11, 0x44}},
+		{ShmFormatXbgr8888, []byte{0x33, 0x22, 0x11, 0xff}},
+		{ShmFormatRgba8888, []byte{0x44, 0x11, 0x22, 0x33}},
+		{ShmFormatRgbx8888, []byte{0xff, 0x11, 0x22, 0x33}},
+		{ShmFormatBgra8888, []byte{0x44, 0x33, 0x22, 0x11}},
+		{ShmFormatBgrx8888, []byte{0xff, 0x33, 0x22, 0x11}},
+	}
+	for _, tt := range tests {
+		dst := newTestPixels(t, tt.f, 1, 1)
+		if err := ConvertPixels(dst, src, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := dst.Planes[0][:4]; !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestYCbCrMatrices(t *testing.T) {
+	// Reference values computed from the matrix definitions.
+	tests := []struct {
+		mat       YCbCrMatrix
+		full      bool
+		r, g, b   byte
+		y, cb, cr byte
+	}{
+		{BT601, false, 0, 0, 0, 16, 128, 128},
+		{BT601, false, 255, 255, 255, 235, 128, 128},
+		{BT601, false, 255, 0, 0, 81, 90, 240},
+		{BT601, false, 0, 255, 0, 145, 54, 34},
+		{BT601, false, 0, 0, 255, 41, 240, 110},
+		{BT601, true, 255, 0, 0, 76, 85, 255},
+		{BT601, true, 0, 0, 255, 29, 255, 107},
+		{BT709, false, 255, 0, 0, 63, 102, 240},
+		{BT709, false, 0, 255, 0, 173, 42, 26},
+		{BT709, false, 0, 0, 255, 32, 240, 118},
+		{BT709, true, 255, 255, 255, 255, 128, 128},
+		{BT2020, false, 255, 0, 0, 74, 97, 240},
+		{BT2020, false, 0, 255, 0, 164, 47, 25},
+		{BT2020, false, 0, 0, 255, 29, 240, 119},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s/full=%t/%d,%d,%d", tt.mat, tt.full, tt.r, tt.g, tt.b)
+		t.Run(name, func(t *testing.T) {
+			opts := &ConvertOptions{Matrix: tt.mat, FullRange: tt.full}
+			rgb := newTestPixels(t, ShmFormatXrgb8888, 1, 1)
+			copy(rgb.Planes[0], []byte{tt.b, tt.g, tt.r, 0xff})
+			yuv := newTestPixels(t, ShmFormatYuv444, 1, 1)
+			if err := ConvertPixels(yuv, rgb, opts); err != nil {
+				t.Fatal(err)
+			}
+			y, cb, cr := yuv.Planes[0][0], yuv.Planes[1][0], yuv.Planes[2][0]
+			if y != tt.y || cb != tt.cb || cr != tt.cr {
+				t.Errorf("got YCbCr %d,%d,%d, want %d,%d,%d", y, cb, cr, tt.y, tt.cb, tt.cr)
+			}
+
+			// Converting back takes the fixed-point path and should get close to the
+			// original color.
+			back := newTestPixels(t, ShmFormatXrgb8888, 1, 1)
+			if err := ConvertPixels(back, yuv, opts); err != nil {
+				t.Fatal(err)
+			}
+			got := back.Planes[0][:3]
+			for i, want := range []byte{tt.b, tt.g, tt.r} {
+				if d := int(got[i]) - int(want); d < -2 || d > 2 {
+					t.Errorf("round trip: got BGR % x, want %02x %02x %02x", got, tt.b, tt.g, tt.r)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestConvertYUV(t *testing.T) {
+	// Each image has a single color so that chroma subsampling doesn't lose information. The
+	// odd dimensions exercise partial chroma blocks.
+	const w, h = 5, 3
+	colors := [][3]byte{{0, 0, 0}, {255, 255, 255}, {200, 40, 90}, {30, 160, 220}}
+	for _, yf := range formatsOf(false) {
+		for _, mat := range []YCbCrMatrix{BT601, BT709, BT2020} {
+			for _, full := range []bool{false, true} {
+				opts := &ConvertOptions{Matrix: mat, FullRange: full}
+				t.Run(fmt.Sprintf("%s/%s/full=%t", yf, mat, full), func(t *testing.T) {
+					for _, c := range colors {
+						src := newTestPixels(t, ShmFormatArgb8888, w, h)
+						for y := 0; y < h; y++ {
+							for x := 0; x < w; x++ {
+								copy(src.Planes[0][y*src.Strides[0]+x*4:], []byte{c[2], c[1], c[0], 0xff})
+							}
+						}
+						yuv := newTestPixels(t, yf, w, h)
+						if err := ConvertPixels(yuv, src, opts); err != nil {
+							t.Fatal(err)
+						}
+
+						// Decode with both the fixed-point fast path and the generic float path.
+						for _, df := range []ShmFormat{ShmFormatArgb8888, ShmFormatArgb16161616} {
+							dst := newTestPixels(t, df, w, h)
+							if err := ConvertPixels(dst, yuv, opts); err != nil {
+								t.Fatal(err)
+							}
+							dl := pixelLayouts[df].rgb
+							out := make([]float32, w*4)
+							for y := 0; y < h; y++ {
+								dl.decodeRow(out, dst.Planes[0][y*dst.Strides[0]:], w)
+								for x := 0; x < w; x++ {
+									for i := 0; i < 3; i++ {
+										want := float32(c[i]) / 255
+										if d := out[x*4+i] - want; d < -3.0/255 || d > 3.0/255 {
+											t.Fatalf("%s: color %v: pixel (%d, %d) channel %d is %g, want %g", df, c, x, y, i, out[x*4+i], want)
+										}
+									}
+									if a := out[x*4+3]; a != 1 {
+										t.Fatalf("%s: pixel (%d, %d) has alpha %g", df, x, y, a)
+									}
+								}
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestConvertYUVFastPathMatchesGeneric(t *testing.T) {
+	const w, h = 16, 16
+	for _, mat := range []YCbCrMatrix{BT601, BT709, BT2020} {
+		for _, full := range []bool{false, true} {
+			opts := &ConvertOptions{Matrix: mat, FullRange: full}
+			src := newTestPixels(t, ShmFormatYuv444, w, h)
+			for i := 0; i < w*h; i++ {
+				x, y := i%w, i/w
+				src.Planes[0][y*src.Strides[0]+x] = byte(i)
+				src.Planes[1][y*src.Strides[1]+x] = byte(i * 7)
+				src.Planes[2][y*src.Strides[2]+x] = byte(i * 13)
+			}
+			fast := newTestPixels(t, ShmFormatXrgb8888, w, h)
+			slow := newTestPixels(t, ShmFormatXrgb2101010, w, h)
+			if err := ConvertPixels(fast, src, opts); err != nil {
+				t.Fatal(err)
+			}
+			if err := ConvertPixels(slow, src, opts); err != nil {
+				t.Fatal(err)
+			}
+			fo, so := make([]float32, w*4), make([]float32, w*4)
+			for y := 0; y < h; y++ {
+				pixelLayouts[ShmFormatXrgb8888].rgb.decodeRow(fo, fast.Planes[0][y*fast.Strides[0]:], w)
+				pixelLayouts[ShmFormatXrgb2101010].rgb.decodeRow(so, slow.Planes[0][y*slow.Strides[0]:], w)
+				for i := range fo {
+					if d := fo[i] - so[i]; d < -1.5/255 || d > 1.5/255 {
+						t.Fatalf("%s full=%t: pixel (%d, %d) channel %d: fixed point %g, float %g", mat, full, i/4, y, i%4, fo[i], so[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConvertPixelsErrors(t *testing.T) {
+	a := newTestPixels(t, ShmFormatArgb8888, 2, 2)
+	if err := ConvertPixels(newTestPixels(t, ShmFormatArgb8888, 3, 2), a, nil); err == nil {
+		t.Error("mismatched sizes: no error")
+	}
+	if err := ConvertPixels(a, &Pixels{Format: ShmFormatC8, Width: 2, Height: 2}, nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("unsupported format: got %v", err)
+	}
+	short := newTestPixels(t, ShmFormatNv12, 2, 2)
+	short.Planes[1] = short.Planes[1][:1]
+	if err := ConvertPixels(a, short, nil); err == nil {
+		t.Error("short chroma plane: no error")
+	}
+	narrow := newTestPixels(t, ShmFormatArgb8888, 2, 2)
+	narrow.Strides[0] = 4
+	if err := ConvertPixels(narrow, a, nil); err == nil {
+		t.Error("small stride: no error")
+	}
+}
+
+func TestHalfFloat(t *testing.T) {
+	for h := 0; h < 1<<16; h++ {
+		f := halfToFloat(uint16(h))
+		if f != f {
+			if g := floatToHalf(f); g&0x7c00 != 0x7c00 || g&0x3ff == 0 {
+				t.Errorf("NaN %#04x round-tripped to %#04x", h, g)
+			}
+			continue
+		}
+		if g := floatToHalf(f); g != uint16(h) {
+			t.Errorf("%#04x → %g → %#04x", h, f, g)
+		}
+	}
+	tests := []struct {
+		f    float32
+		want uint16
+	}{
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{65520, 0x7c00},
+		{1 + 1.0/2048, 0x3c00},
+		{1 + 3.0/2048, 0x3c02},
+		{float32(math.Inf(-1)), 0xfc00},
+		{1e-10, 0},
+	}
+	for _, tt := range tests {
+		if got := floatToHalf(tt.f); got != tt.want {
+			t.Errorf("floatToHalf(%g) = %#04x, want %#04x", tt.f, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package wayland
+
+// #include <wayland-client.h>
+// #include "linux-dmabuf-v1-client-protocol.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var ZwpLinuxDmabufV1Interface = &C.zwp_linux_dmabuf_v1_interface
+
+// Special format modifiers, as defined in drm_fourcc.h.
+const (
+	// DmabufModifierLinear is the modifier of buffers without tiling or compression.
+	DmabufModifierLinear uint64 = 0
+	// DmabufModifierInvalid denotes an implicit modifier, to be derived from the dmabuf by
+	// the driver.
+	DmabufModifierInvalid uint64 = 0x00ffffffffffffff
+)
+
+type LinuxBufferParamsFlags uint32
+
+const (
+	LinuxBufferParamsFlagsYInvert     LinuxBufferParamsFlags = C.ZWP_LINUX_BUFFER_PARAMS_V1_FLAGS_Y_INVERT
+	LinuxBufferParamsFlagsInterlaced  LinuxBufferParamsFlags = C.ZWP_LINUX_BUFFER_PARAMS_V1_FLAGS_INTERLACED
+	LinuxBufferParamsFlagsBottomFirst LinuxBufferParamsFlags = C.ZWP_LINUX_BUFFER_PARAMS_V1_FLAGS_BOTTOM_FIRST
+)
+
+type DmabufTrancheFlags uint32
+
+const (
+	DmabufTrancheFlagsScanout DmabufTrancheFlags = C.ZWP_LINUX_DMABUF_FEEDBACK_V1_TRANCHE_FLAGS_SCANOUT
+)
+
+// DmabufFormat is a format and modifier pair supported by the compositor.
+type DmabufFormat struct {
+	Format   ShmFormat
+	Modifier uint64
+}
+
+// DmabufTranche is a set of format and modifier pairs the compositor supports for buffers
+// allocated on TargetDevice. Tranches are sent in decreasing order of preference.
+type DmabufTranche struct {
+	// TargetDevice is a dev_t.
+	TargetDevice uint64
+	Flags        DmabufTrancheFlags
+	Formats      []DmabufFormat
+}
+
+// DmabufFeedback is the complete set of dmabuf parameters sent between two done events of a
+// LinuxDmabufFeedback.
+type DmabufFeedback struct {
+	// MainDevice is the dev_t of the device the compositor prefers for allocations that
+	// cannot be scanned out directly.
+	MainDevice uint64
+	// FormatTable is the most recently received format table. Tranches refer to its entries.
+	FormatTable []DmabufFormat
+	Tranches    []DmabufTranche
+}
+
+func (reg *Registry) BindZwpLinuxDmabufV1(name uint32, vers uint32) *LinuxDmabuf {
+	vers = clampVersion(ZwpLinuxDmabufV1Interface, vers)
+	defer creating(reg)()
+	out := &LinuxDmabuf{
+		dsp:  reg.dsp,
+		hnd:  (*C.struct_zwp_linux_dmabuf_v1)(reg.bind(name, ZwpLinuxDmabufV1Interface, vers)),
+		vers: int(vers),
+	}
+	reg.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
+	return out
+}
+
+type LinuxDmabuf struct {
+	dsp  *Display
+	hnd  *C.struct_zwp_linux_dmabuf_v1
+	id   uint32
+	vers int
+	// OnFormat and OnModifier are only sent by compositors implementing versions 3 and
+	// earlier. Newer versions advertise formats via feedback objects.
+	OnFormat   func(format ShmFormat)
+	OnModifier func(format ShmFormat, modifier uint64)
+}
+
+func (dmabuf *LinuxDmabuf) Version() int           { return dmabuf.vers }
+func (dmabuf *LinuxDmabuf) ID() uint32             { return proxyID(unsafe.Pointer(dmabuf.hnd), dmabuf.id) }
+func (dmabuf *LinuxDmabuf) Interface() string      { return "zwp_linux_dmabuf_v1" }
+func (dmabuf *LinuxDmabuf) Handle() unsafe.Pointer { return unsafe.Pointer(dmabuf.hnd) }
+func (dmabuf *LinuxDmabuf) display() *Display      { return dmabuf.dsp }
+
+func (dmabuf *LinuxDmabuf) internal() any {
+	return (*linuxDmabuf)(dmabuf)
+}
+
+type linuxDmabuf LinuxDmabuf
+
+func (dmabuf *linuxDmabuf) Format(format uint32) {
+	f := ShmFormatFromFourcc(format)
+	if dmabuf.OnFormat != nil {
+		dmabuf.OnFormat(f)
+	}
+	if dmabuf.dsp.observed((*LinuxDmabuf)(dmabuf)) {
+		dmabuf.dsp.deliver((*LinuxDmabuf)(dmabuf), LinuxDmabufFormatEvent{(*LinuxDmabuf)(dmabuf), f})
+	}
+}
+
+func (dmabuf *linuxDmabuf) Modifier(format, modifierHi, modifierLo uint32) {
+	f := ShmFormatFromFourcc(format)
+	mod := uint64(modifierHi)<<32 | uint64(modifierLo)
+	if dmabuf.OnModifier != nil {
+		dmabuf.OnModifier(f, mod)
+	}
+	if dmabuf.dsp.observed((*LinuxDmabuf)(dmabuf)) {
+		dmabuf.dsp.deliver((*LinuxDmabuf)(dmabuf), LinuxDmabufModifierEvent{(*LinuxDmabuf)(dmabuf), f, mod})
+	}
+}
+
+func (dmabuf *LinuxDmabuf) Destroy() {
+	if dmabuf.hnd == nil {
+		dmabuf.dsp.destroyedTwice(dmabuf)
+		return
+	}
+	dmabuf.id = dmabuf.ID()
+	if dmabuf.dsp.traced(dmabuf) {
+		dmabuf.dsp.traceRequest(dmabuf, "destroy")
+	}
+	dmabuf.dsp.forget((*C.struct_wl_proxy)(dmabuf.hnd))
+	C.zwp_linux_dmabuf_v1_destroy(dmabuf.hnd)
+	dmabuf.hnd = nil
+}
+
+func (dmabuf *LinuxDmabuf) CreateParams() *LinuxBufferParams {
+	checkLive(dmabuf)
+	defer creating(dmabuf)()
+	params := &LinuxBufferParams{
+		dsp:  dmabuf.dsp,
+		hnd:  C.zwp_linux_dmabuf_v1_create_params(dmabuf.hnd),
+		vers: dmabuf.vers,
+	}
+	dmabuf.dsp.add((*C.struct_wl_proxy)(params.hnd), params)
+	if dmabuf.dsp.traced(dmabuf) {
+		dmabuf.dsp.traceRequest(dmabuf, "create_params", params)
+	}
+	return params
+}
+
+// DefaultFeedback returns feedback not tied to any surface. It requires version 4.
+func (dmabuf *LinuxDmabuf) DefaultFeedback() (*LinuxDmabufFeedback, error) {
+	checkLive(dmabuf)
+	defer creating(dmabuf)()
+	if err := checkVersion(dmabuf, "get_default_feedback", C.ZWP_LINUX_DMABUF_V1_GET_DEFAULT_FEEDBACK_SINCE_VERSION); err != nil {
+		return nil, err
+	}
+	fb := &LinuxDmabufFeedback{
+		dsp:  dmabuf.dsp,
+		hnd:  C.zwp_linux_dmabuf_v1_get_default_feedback(dmabuf.hnd),
+		vers: dmabuf.vers,
+	}
+	dmabuf.dsp.add((*C.struct_wl_proxy)(fb.hnd), fb)
+	if dmabuf.dsp.traced(dmabuf) {
+		dmabuf.dsp.traceRequest(dmabuf, "get_default_feedback", fb)
+	}
+	return fb, nil
+}
+
+// SurfaceFeedback returns feedback for buffers attached to surf. It requires version 4.
+func (dmabuf *LinuxDmabuf) SurfaceFeedback(surf *Surface) (*LinuxDmabufFeedback, error) {
+	checkLive(dmabuf)
+	defer creating(dmabuf)()
+	checkLive(surf)
+	if err := checkVersion(dmabuf, "get_surface_feedback", C.ZWP_LINUX_DMABUF_V1_GET_SURFACE_FEEDBACK_SINCE_VERSION); err != nil {
+		return nil, err
+	}
+	fb := &LinuxDmabufFeedback{
+		dsp:  dmabuf.dsp,
+		hnd:  C.zwp_linux_dmabuf_v1_get_surface_feedback(dmabuf.hnd, surf.hnd),
+		vers: dmabuf.vers,
+	}
+	dmabuf.dsp.add((*C.struct_wl_proxy)(fb.hnd), fb)
+	if dmabuf.dsp.traced(dmabuf) {
+		dmabuf.dsp.traceRequest(dmabuf, "get_surface_feedback", fb, surf)
+	}
+	return fb, nil
+}
+
+// LinuxBufferParams collects the planes of a dmabuf-based buffer. It can be used to create a
+// single Buffer and should be destroyed afterwards.
+type LinuxBufferParams struct {
+	dsp       *Display
+	hnd       *C.struct_zwp_linux_buffer_params_v1
+	id        uint32
+	vers      int
+	OnCreated func(buf *Buffer)
+	OnFailed  func()
+}
+
+func (params *LinuxBufferParams) Version() int           { return params.vers }
+func (params *LinuxBufferParams) ID() uint32             { return proxyID(unsafe.Pointer(params.hnd), params.id) }
+func (params *LinuxBufferParams) Interface() string      { return "zwp_linux_buffer_params_v1" }
+func (params *LinuxBufferParams) Handle() unsafe.Pointer { return unsafe.Pointer(params.hnd) }
+func (params *LinuxBufferParams) display() *Display      { return params.dsp }
+
+func (params *LinuxBufferParams) internal() any {
+	return (*linuxBufferParams)(params)
+}
+
+type linuxBufferParams LinuxBufferParams
+
+func (params *linuxBufferParams) Created(hnd unsafe.Pointer) {
+	buf := &Buffer{
+		dsp:  params.dsp,
+		hnd:  (*C.struct_wl_buffer)(hnd),
+		vers: int(C.wl_proxy_get_version((*C.struct_wl_proxy)(hnd))),
+	}
+	params.dsp.add((*C.struct_wl_proxy)(buf.hnd), buf)
+	observed := params.dsp.observed((*LinuxBufferParams)(params))
+	if params.OnCreated != nil {
+		params.OnCreated(buf)
+	} else if !observed {
+		// Nobody will ever use this buffer.
+		buf.Destroy()
+		return
+	}
+	if observed {
+		params.dsp.deliver((*LinuxBufferParams)(params), LinuxBufferParamsCreatedEvent{(*LinuxBufferParams)(params), buf})
+	}
+}
+
+func (params *linuxBufferParams) Failed() {
+	if params.OnFailed != nil {
+		params.OnFailed()
+	}
+	if params.dsp.observed((*LinuxBufferParams)(params)) {
+		params.dsp.deliver((*LinuxBufferParams)(params), LinuxBufferParamsFailedEvent{(*LinuxBufferParams)(params)})
+	}
+}
+
+func (params *LinuxBufferParams) Destroy() {
+	if params.hnd == nil {
+		params.dsp.destroyedTwice(params)
+		return
+	}
+	params.id = params.ID()
+	if params.dsp.traced(params) {
+		params.dsp.traceRequest(params, "destroy")
+	}
+	params.dsp.forget((*C.struct_wl_proxy)(params.hnd))
+	C.zwp_linux_buffer_params_v1_destroy(params.hnd)
+	params.hnd = nil
+}
+
+// Add adds a plane. The file descriptor is duplicated when the request is sent, and the caller
+// remains responsible for closing fd.
+func (params *LinuxBufferParams) Add(fd int, plane, offset, stride uint32, modifier uint64) {
+	checkLive(params)
+	C.zwp_linux_buffer_params_v1_add(
+		params.hnd,
+		C.int32_t(fd),
+		C.uint32_t(plane),
+		C.uint32_t(offset),
+		C.uint32_t(stride),
+		C.uint32_t(modifier>>32),
+		C.uint32_t(modifier),
+	)
+	if params.dsp.traced(params) {
+		params.dsp.traceRequest(params, "add", fd, plane, offset, stride, modifier>>32, modifier&0xffffffff)
+	}
+}
+
+// Create asks the compositor to import the planes. The result is reported by OnCreated or
+// OnFailed.
+func (params *LinuxBufferParams) Create(width, height int32, format ShmFormat, flags LinuxBufferParamsFlags) {
+	checkLive(params)
+	C.zwp_linux_buffer_params_v1_create(params.hnd, C.int32_t(width), C.int32_t(height), C.uint32_t(format.Fourcc()), C.uint32_t(flags))
+	if params.dsp.traced(params) {
+		params.dsp.traceRequest(params, "create", width, height, format, flags)
+	}
+}
+
+// CreateImmed creates a buffer without waiting for the compositor to import the planes. Import
+// failures either cause a protocol error or OnFailed to be called, in which case the buffer is
+// invalid. It requires version 2.
+func (params *LinuxBufferParams) CreateImmed(width, height int32, format ShmFormat, flags LinuxBufferParamsFlags) (*Buffer, error) {
+	checkLive(params)
+	defer creating(params)()
+	if err := checkVersion(params, "create_immed", C.ZWP_LINUX_BUFFER_PARAMS_V1_CREATE_IMMED_SINCE_VERSION); err != nil {
+		return nil, err
+	}
+	buf := &Buffer{
+		dsp:  params.dsp,
+		hnd:  C.zwp_linux_buffer_params_v1_create_immed(params.hnd, C.int32_t(width), C.int32_t(height), C.uint32_t(format.Fourcc()), C.uint32_t(flags)),
+		vers: params.vers,
+	}
+	params.dsp.add((*C.struct_wl_proxy)(buf.hnd), buf)
+	if params.dsp.traced(params) {
+		params.dsp.traceRequest(params, "create_immed", buf, width, height, format, flags)
+	}
+	return buf, nil
+}
+
+// LinuxDmabufFeedback delivers the devices and format/modifier pairs preferred by the
+// compositor. The individual events are collected and delivered as a whole to OnDone, which
+// is called initially and whenever the parameters change. If the compositor sent malformed
+// parameters, OnDone receives a non-nil error alongside whatever could be decoded.
+type LinuxDmabufFeedback struct {
+	dsp    *Display
+	hnd    *C.struct_zwp_linux_dmabuf_feedback_v1
+	id     uint32
+	vers   int
+	OnDone func(fb *DmabufFeedback, err error)
+
+	// state accumulated between done events
+	mainDevice  uint64
+	formatTable []DmabufFormat
+	tranches    []DmabufTranche
+	tranche     DmabufTranche
+	// err records the first error encountered since the last done event.
+	err error
+}
+
+func (fb *LinuxDmabufFeedback) Version() int           { return fb.vers }
+func (fb *LinuxDmabufFeedback) ID() uint32             { return proxyID(unsafe.Pointer(fb.hnd), fb.id) }
+func (fb *LinuxDmabufFeedback) Interface() string      { return "zwp_linux_dmabuf_feedback_v1" }
+func (fb *LinuxDmabufFeedback) Handle() unsafe.Pointer { return unsafe.Pointer(fb.hnd) }
+func (fb *LinuxDmabufFeedback) display() *Display      { return fb.dsp }
+
+func (fb *LinuxDmabufFeedback) internal() any {
+	return (*linuxDmabufFeedback)(fb)
+}
+
+type linuxDmabufFeedback LinuxDmabufFeedback
+
+func (fb *linuxDmabufFeedback) Done() {
+	err := fb.err
+	fb.err = nil
+	out := &DmabufFeedback{
+		MainDevice:  fb.mainDevice,
+		FormatTable: fb.formatTable,
+		Tranches:    fb.tranches,
+	}
+	// All tranches get sent again when anything changes. The format table and main device
+	// are kept, as the compositor needn't resend them.
+	fb.tranches = nil
+	if fb.OnDone != nil {
+		fb.OnDone(out, err)
+	}
+	if fb.dsp.observed((*LinuxDmabufFeedback)(fb)) {
+		fb.dsp.deliver((*LinuxDmabufFeedback)(fb), LinuxDmabufFeedbackDoneEvent{(*LinuxDmabufFeedback)(fb), out, err})
+	}
+}
+
+func (fb *linuxDmabufFeedback) Format_table(fd int32, size uint32) {
+	defer syscall.Close(int(fd))
+	table, err := parseDmabufFormatTable(int(fd), size)
+	if err != nil {
+		fb.setErr(err)
+		return
+	}
+	fb.formatTable = table
+}
+
+func (fb *linuxDmabufFeedback) Main_device(dev []byte) {
+	var err error
+	fb.mainDevice, err = decodeDevT(dev)
+	fb.setErr(err)
+}
+
+func (fb *linuxDmabufFeedback) Tranche_target_device(dev []byte) {
+	var err error
+	fb.tranche.TargetDevice, err = decodeDevT(dev)
+	fb.setErr(err)
+}
+
+func (fb *linuxDmabufFeedback) Tranche_formats(indices []uint16) {
+	for _, idx := range indices {
+		if int(idx) >= len(fb.formatTable) {
+			fb.setErr(fmt.Errorf("format table index %d out of range [0, %d)", idx, len(fb.formatTable)))
+			continue
+		}
+		fb.tranche.Formats = append(fb.tranche.Formats, fb.formatTable[idx])
+	}
+}
+
+func (fb *linuxDmabufFeedback) Tranche_flags(flags uint32) {
+	fb.tranche.Flags = DmabufTrancheFlags(flags)
+}
+
+func (fb *linuxDmabufFeedback) Tranche_done() {
+	fb.tranches = append(fb.tranches, fb.tranche)
+	fb.tranche = DmabufTranche{}
+}
+
+func (fb *linuxDmabufFeedback) setErr(err error) {
+	if fb.err == nil {
+		fb.err = err
+	}
+}
+
+func (fb *LinuxDmabufFeedback) Destroy() {
+	if fb.hnd == nil {
+		fb.dsp.destroyedTwice(fb)
+		return
+	}
+	fb.id = fb.ID()
+	if fb.dsp.traced(fb) {
+		fb.dsp.traceRequest(fb, "destroy")
+	}
+	fb.dsp.forget((*C.struct_wl_proxy)(fb.hnd))
+	C.zwp_linux_dmabuf_feedback_v1_destroy(fb.hnd)
+	fb.hnd = nil
+}
+
+// dmabufFormatTableEntrySize is the size of an entry in the format table: a 32-bit format, 4
+// bytes of padding and a 64-bit modifier.
+const dmabufFormatTableEntrySize = 16
+
+func parseDmabufFormatTable(fd int, size uint32) ([]DmabufFormat, error) {
+	if size%dmabufFormatTableEntrySize != 0 {
+		return nil, fmt.Errorf("invalid format table size %d", size)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	data, err := syscall.Mmap(fd, 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't map format table: %w", err)
+	}
+	defer syscall.Munmap(data)
+	return decodeDmabufFormatTable(data), nil
+}
+
+func decodeDmabufFormatTable(data []byte) []DmabufFormat {
+	out := make([]DmabufFormat, len(data)/dmabufFormatTableEntrySize)
+	for i := range out {
+		entry := data[i*dmabufFormatTableEntrySize:]
+		out[i] = DmabufFormat{
+			Format:   ShmFormatFromFourcc(binary.NativeEndian.Uint32(entry)),
+			Modifier: binary.NativeEndian.Uint64(entry[8:]),
+		}
+	}
+	return out
+}
+
+// decodeDevT decodes a dev_t sent as an array in native byte order.
+func decodeDevT(b []byte) (uint64, error) {
+	switch len(b) {
+	case 4:
+		return uint64(binary.NativeEndian.Uint32(b)), nil
+	case 8:
+		return binary.NativeEndian.Uint64(b), nil
+	default:
+		return 0, fmt.Errorf("unexpected dev_t size %d", len(b))
+	}
+}
@@ -0,0 +1,252 @@
+package wayland
+
+import (
+	"encoding/binary"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+// zwp_linux_dmabuf_feedback_v1 event opcodes
+const (
+	feedbackDone uint16 = iota
+	feedbackFormatTable
+	feedbackMainDevice
+	feedbackTrancheDone
+	feedbackTrancheTargetDevice
+	feedbackTrancheFormats
+	feedbackTrancheFlags
+)
+
+func newDmabufFeedback(t *testing.T) (*testServer, *Display, *LinuxDmabufFeedback) {
+	t.Helper()
+	s, dsp := newTestServer(t, nil, testGlobal{1, "zwp_linux_dmabuf_v1", 4})
+	dmabuf := bindGlobal[*LinuxDmabuf](t, dsp, 1, 4)
+	fb, err := dmabuf.DefaultFeedback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dsp, fb
+}
+
+// formatTableFd returns a file containing the encoded format table.
+func formatTableFd(t *testing.T, formats []DmabufFormat) (testFd, uint32) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "format-table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, df := range formats {
+		var entry [dmabufFormatTableEntrySize]byte
+		binary.NativeEndian.PutUint32(entry[:], df.Format.Fourcc())
+		binary.NativeEndian.PutUint64(entry[8:], df.Modifier)
+		if _, err := f.Write(entry[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testFd(fd), uint32(len(formats) * dmabufFormatTableEntrySize)
+}
+
+func devT(dev uint64) []byte {
+	return binary.NativeEndian.AppendUint64(nil, dev)
+}
+
+func indices(idx ...uint16) []byte {
+	var out []byte
+	for _, i := range idx {
+		out = binary.NativeEndian.AppendUint16(out, i)
+	}
+	return out
+}
+
+func TestDmabufFeedback(t *testing.T) {
+	s, dsp, fb := newDmabufFeedback(t)
+	var got []*DmabufFeedback
+	fb.OnDone = func(out *DmabufFeedback, err error) {
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		got = append(got, out)
+	}
+
+	table := []DmabufFormat{
+		{ShmFormatArgb8888, DmabufModifierLinear},
+		{ShmFormatXrgb8888, 0x0100000000000001},
+		{ShmFormatNv12, DmabufModifierInvalid},
+	}
+	fd, size := formatTableFd(t, table)
+	id := fb.ID()
+	s.send(id, feedbackFormatTable, fd, size)
+	s.send(id, feedbackMainDevice, devT(0xe200))
+	s.send(id, feedbackTrancheTargetDevice, devT(0xe280))
+	s.send(id, feedbackTrancheFormats, indices(2, 0))
+	s.send(id, feedbackTrancheFlags, uint32(DmabufTrancheFlagsScanout))
+	s.send(id, feedbackTrancheDone)
+	s.send(id, feedbackTrancheTargetDevice, devT(0xe200))
+	s.send(id, feedbackTrancheFormats, indices(0, 1, 2))
+	s.send(id, feedbackTrancheDone)
+	s.send(id, feedbackDone)
+	roundtrip(t, dsp)
+
+	if len(got) != 1 {
+		t.Fatalf("got %d done events, want 1", len(got))
+	}
+	if !slices.Equal(got[0].FormatTable, table) {
+		t.Errorf("got format table %v, want %v", got[0].FormatTable, table)
+	}
+	if got[0].MainDevice != 0xe200 {
+		t.Errorf("got main device %#x, want 0xe200", got[0].MainDevice)
+	}
+	want := []DmabufTranche{
+		{TargetDevice: 0xe280, Flags: DmabufTrancheFlagsScanout, Formats: []DmabufFormat{table[2], table[0]}},
+		{TargetDevice: 0xe200, Formats: table},
+	}
+	if len(got[0].Tranches) != len(want) {
+		t.Fatalf("got %d tranches, want %d", len(got[0].Tranches), len(want))
+	}
+	for i, tr := range got[0].Tranches {
+		if tr.TargetDevice != want[i].TargetDevice || tr.Flags != want[i].Flags || !slices.Equal(tr.Formats, want[i].Formats) {
+			t.Errorf("tranche %d: got %+v, want %+v", i, tr, want[i])
+		}
+	}
+
+	// Updates only resend the tranches; the format table and main device are kept.
+	s.send(id, feedbackTrancheTargetDevice, devT(0xe200))
+	s.send(id, feedbackTrancheFormats, indices(1))
+	s.send(id, feedbackTrancheDone)
+	s.send(id, feedbackDone)
+	roundtrip(t, dsp)
+	if len(got) != 2 {
+		t.Fatalf("got %d done events, want 2", len(got))
+	}
+	if !slices.Equal(got[1].FormatTable, table) || got[1].MainDevice != 0xe200 {
+		t.Errorf("format table or main device weren't kept: %+v", got[1])
+	}
+	if len(got[1].Tranches) != 1 || !slices.Equal(got[1].Tranches[0].Formats, table[1:2]) {
+		t.Errorf("got tranches %+v", got[1].Tranches)
+	}
+}
+
+func TestDmabufFeedbackErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(s *testServer, id uint32)
+	}{
+		{"table size", func(s *testServer, id uint32) {
+			fd, _ := formatTableFd(t, []DmabufFormat{{ShmFormatArgb8888, 0}})
+			s.send(id, feedbackFormatTable, fd, uint32(dmabufFormatTableEntrySize+4))
+		}},
+		{"index", func(s *testServer, id uint32) {
+			fd, size := formatTableFd(t, []DmabufFormat{{ShmFormatArgb8888, 0}})
+			s.send(id, feedbackFormatTable, fd, size)
+			s.send(id, feedbackTrancheFormats, indices(0, 1))
+			s.send(id, feedbackTrancheDone)
+		}},
+		{"dev_t", func(s *testServer, id uint32) {
+			s.send(id, feedbackMainDevice, []byte{1, 2, 3})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dsp, fb := newDmabufFeedback(t)
+			var errs []error
+			fb.OnDone = func(out *DmabufFeedback, err error) { errs = append(errs, err) }
+			tt.send(s, fb.ID())
+			s.send(fb.ID(), feedbackDone)
+			// The error is reported once.
+			s.send(fb.ID(), feedbackDone)
+			roundtrip(t, dsp)
+			if len(errs) != 2 || errs[0] == nil || errs[1] != nil {
+				t.Errorf("got errors %v, want one error followed by nil", errs)
+			}
+		})
+	}
+}
+
+func TestDmabufCreated(t *testing.T) {
+	// zwp_linux_buffer_params_v1.created carries a new_id allocated by the server.
+	s, dsp := newTestServer(t, nil, testGlobal{1, "zwp_linux_dmabuf_v1", 4})
+	dmabuf := bindGlobal[*LinuxDmabuf](t, dsp, 1, 4)
+	params := dmabuf.CreateParams()
+	var buf *Buffer
+	params.OnCreated = func(b *Buffer) { buf = b }
+	s.send(params.ID(), 0, uint32(0xff000000))
+	roundtrip(t, dsp)
+	if buf == nil {
+		t.Fatal("OnCreated wasn't called")
+	}
+	if buf.ID() != 0xff000000 || buf.Version() != 4 {
+		t.Errorf("got buffer %d version %d, want %d version 4", buf.ID(), buf.Version(), 0xff000000)
+	}
+	if got := dsp.LiveProxies()["wl_buffer"]; got != 1 {
+		t.Errorf("got %d live buffers, want 1", got)
+	}
+}
+
+func TestDispatchClosesUndeliveredFds(t *testing.T) {
+	// Events following a panicking handler aren't delivered, and nobody else will close
+	// their file descriptors.
+	s, dsp, fb := newDmabufFeedback(t)
+	fb.OnDone = func(*DmabufFeedback, error) { panic("boom") }
+
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(p[0])
+	s.send(fb.ID(), feedbackDone)
+	s.send(fb.ID(), feedbackFormatTable, testFd(p[1]), uint32(0))
+	func() {
+		defer func() {
+			if _, ok := recover().(*PanicError); !ok {
+				t.Error("Roundtrip didn't panic with a *PanicError")
+			}
+		}()
+		dsp.Roundtrip()
+	}()
+
+	// The read end sees EOF once the client closed its copy of the write end.
+	if n, err := syscall.Read(p[0], make([]byte, 1)); n != 0 || err != nil {
+		t.Errorf("file descriptor wasn't closed: read returned %d, %v", n, err)
+	}
+}
+
+func TestDispatchDestroysUndeliveredObjects(t *testing.T) {
+	// Objects created by events that aren't delivered are destroyed on both sides.
+	destroyed := make(chan uint32, 1)
+	s, dsp := newTestServer(t, func(s *testServer, req testRequest) {
+		if req.id >= 0xff000000 && req.opcode == 0 {
+			// wl_buffer.destroy
+			destroyed <- req.id
+		}
+	}, testGlobal{1, "zwp_linux_dmabuf_v1", 4})
+	dmabuf := bindGlobal[*LinuxDmabuf](t, dsp, 1, 4)
+	params := dmabuf.CreateParams()
+	params.OnFailed = func() { panic("boom") }
+	params.OnCreated = func(*Buffer) { t.Error("OnCreated was called after a panic") }
+	s.send(params.ID(), 1)
+	s.send(params.ID(), 0, uint32(0xff000000))
+	func() {
+		defer func() {
+			if _, ok := recover().(*PanicError); !ok {
+				t.Error("Roundtrip didn't panic with a *PanicError")
+			}
+		}()
+		dsp.Roundtrip()
+	}()
+	roundtrip(t, dsp)
+	select {
+	case id := <-destroyed:
+		if id != 0xff000000 {
+			t.Errorf("destroyed object %d, want %d", id, 0xff000000)
+		}
+	default:
+		t.Error("the buffer created by the skipped event wasn't destroyed")
+	}
+}
@@ -0,0 +1,68 @@
+package wayland
+
+// #include <wayland-egl.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// EGLWindow is a native window for use with EGL, backed by a Surface. Pass the value returned
+// by Handle as the EGLNativeWindowType to eglCreateWindowSurface.
+type EGLWindow struct {
+	hnd  *C.struct_wl_egl_window
+	surf *Surface
+}
+
+// NewEGLWindow creates an EGLWindow of the given size for surf. The window must be destroyed
+// before the surface.
+func NewEGLWindow(surf *Surface, width, height int) (*EGLWindow, error) {
+	checkLive(surf)
+	hnd := C.wl_egl_window_create(surf.hnd, C.int(width), C.int(height))
+	if hnd == nil {
+		return nil, errors.New("couldn't create EGL window")
+	}
+	return &EGLWindow{hnd: hnd, surf: surf}, nil
+}
+
+// Handle returns the struct wl_egl_window pointer.
+func (win *EGLWindow) Handle() unsafe.Pointer {
+	return unsafe.Pointer(win.hnd)
+}
+
+func (win *EGLWindow) Surface() *Surface {
+	return win.surf
+}
+
+// Resize changes the size of the window. dx and dy specify the offset of the new buffer
+// relative to the current one, as in wl_surface.attach. The new size takes effect
+// when the next buffer is attached, that is, after the next eglSwapBuffers.
+func (win *EGLWindow) Resize(width, height, dx, dy int) {
+	win.checkLive()
+	C.wl_egl_window_resize(win.hnd, C.int(width), C.int(height), C.int(dx), C.int(dy))
+}
+
+// AttachedSize returns the size of the most recently attached buffer.
+func (win *EGLWindow) AttachedSize() (width, height int) {
+	win.checkLive()
+	var w, h C.int
+	C.wl_egl_window_get_attached_size(win.hnd, &w, &h)
+	return int(w), int(h)
+}
+
+// checkLive panics if win has been destroyed, like checkLive does for proxies.
+func (win *EGLWindow) checkLive() {
+	if win.hnd == nil {
+		panic(fmt.Errorf("use of destroyed wayland.EGLWindow: %w", ErrDestroyed))
+	}
+}
+
+func (win *EGLWindow) Destroy() {
+	if win.hnd == nil {
+		panic("double destroy of wayland.EGLWindow")
+	}
+	C.wl_egl_window_destroy(win.hnd)
+	win.hnd = nil
+}
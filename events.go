@@ -0,0 +1,436 @@
+package wayland
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Event is an event received by a proxy, for use with Display.Listen, Display.Events and
+// Subscribe. The concrete types are named after the proxy and the event, such as
+// XdgToplevelConfigureEvent, and hold the same values that get passed to the proxy's On*
+// field.
+type Event interface {
+	// Sender returns the proxy that received the event.
+	Sender() any
+}
+
+type CallbackDoneEvent struct {
+	Callback *Callback
+	Data     uint32
+}
+
+type RegistryGlobalEvent struct {
+	Registry  *Registry
+	Name      uint32
+	Interface string
+	Version   uint32
+}
+
+type RegistryGlobalRemoveEvent struct {
+	Registry *Registry
+	Name     uint32
+}
+
+type WpPresentationClockIDEvent struct {
+	Presentation *WpPresentation
+	ID           uint32
+}
+
+type WpPresentationFeedbackSyncOutputEvent struct {
+	Feedback *WpPresentationFeedback
+	Output   *Output
+}
+
+type WpPresentationFeedbackPresentedEvent struct {
+	Feedback *WpPresentationFeedback
+	Info     PresentationInfo
+}
+
+type WpPresentationFeedbackDiscardedEvent struct {
+	Feedback *WpPresentationFeedback
+}
+
+type OutputGeometryEvent struct {
+	Output                        *Output
+	X, Y                          int32
+	PhysicalWidth, PhysicalHeight int32
+	Subpixel                      int32
+	Make, Model                   string
+	Transform                     int32
+}
+
+type OutputModeEvent struct {
+	Output                 *Output
+	Flags                  uint32
+	Width, Height, Refresh int32
+}
+
+type OutputDoneEvent struct {
+	Output *Output
+}
+
+type OutputScaleEvent struct {
+	Output *Output
+	Factor int32
+}
+
+type OutputNameEvent struct {
+	Output *Output
+	Name   string
+}
+
+type OutputDescriptionEvent struct {
+	Output      *Output
+	Description string
+}
+
+type SurfaceEnterEvent struct {
+	Surface *Surface
+	// Output is nil if the output hasn't been bound.
+	Output *Output
+}
+
+type SurfaceLeaveEvent struct {
+	Surface *Surface
+	// Output is nil if the output hasn't been bound.
+	Output *Output
+}
+
+type SurfacePreferredBufferScaleEvent struct {
+	Surface *Surface
+	Scale   int
+}
+
+type SurfacePreferredBufferTransformEvent struct {
+	Surface   *Surface
+	Transform uint32
+}
+
+type ShmFormatEvent struct {
+	Shm    *Shm
+	Format ShmFormat
+}
+
+type BufferReleaseEvent struct {
+	Buffer *Buffer
+}
+
+type XdgWmBasePingEvent struct {
+	WmBase *XdgWmBase
+	Serial uint32
+}
+
+type XdgSurfaceConfigureEvent struct {
+	Surface *XdgSurface
+	Serial  uint32
+}
+
+type XdgToplevelConfigureEvent struct {
+	Toplevel      *XdgToplevel
+	Width, Height int32
+	States        []uint32
+}
+
+type XdgToplevelCloseEvent struct {
+	Toplevel *XdgToplevel
+}
+
+type XdgToplevelConfigureBoundsEvent struct {
+	Toplevel      *XdgToplevel
+	Width, Height int32
+}
+
+type XdgToplevelWmCapabilitiesEvent struct {
+	Toplevel     *XdgToplevel
+	Capabilities []uint32
+}
+
+type XdgToplevelDecorationConfigureEvent struct {
+	Decoration *XdgToplevelDecoration
+	Mode       XdgToplevelDecorationMode
+}
+
+type LinuxDmabufFormatEvent struct {
+	Dmabuf *LinuxDmabuf
+	Format ShmFormat
+}
+
+type LinuxDmabufModifierEvent struct {
+	Dmabuf   *LinuxDmabuf
+	Format   ShmFormat
+	Modifier uint64
+}
+
+type LinuxBufferParamsCreatedEvent struct {
+	Params *LinuxBufferParams
+	Buffer *Buffer
+}
+
+type LinuxBufferParamsFailedEvent struct {
+	Params *LinuxBufferParams
+}
+
+type LinuxDmabufFeedbackDoneEvent struct {
+	Feedback *LinuxDmabufFeedback
+	Result   *DmabufFeedback
+	Err      error
+}
+
+type WpFractionalScalePreferredScaleEvent struct {
+	FractionalScale *WpFractionalScale
+	Scale           float64
+}
+
+func (ev CallbackDoneEvent) Sender() any                     { return ev.Callback }
+func (ev RegistryGlobalEvent) Sender() any                   { return ev.Registry }
+func (ev RegistryGlobalRemoveEvent) Sender() any             { return ev.Registry }
+func (ev WpPresentationClockIDEvent) Sender() any            { return ev.Presentation }
+func (ev WpPresentationFeedbackSyncOutputEvent) Sender() any { return ev.Feedback }
+func (ev WpPresentationFeedbackPresentedEvent) Sender() any  { return ev.Feedback }
+func (ev WpPresentationFeedbackDiscardedEvent) Sender() any  { return ev.Feedback }
+func (ev OutputGeometryEvent) Sender() any                   { return ev.Output }
+func (ev OutputModeEvent) Sender() any                       { return ev.Output }
+func (ev OutputDoneEvent) Sender() any                       { return ev.Output }
+func (ev OutputScaleEvent) Sender() any                      { return ev.Output }
+func (ev OutputNameEvent) Sender() any                       { return ev.Output }
+func (ev OutputDescriptionEvent) Sender() any                { return ev.Output }
+func (ev SurfaceEnterEvent) Sender() any                     { return ev.Surface }
+func (ev SurfaceLeaveEvent) Sender() any                     { return ev.Surface }
+func (ev SurfacePreferredBufferScaleEvent) Sender() any      { return ev.Surface }
+func (ev SurfacePreferredBufferTransformEvent) Sender() any  { return ev.Surface }
+func (ev ShmFormatEvent) Sender() any                        { return ev.Shm }
+func (ev BufferReleaseEvent) Sender() any                    { return ev.Buffer }
+func (ev XdgWmBasePingEvent) Sender() any                    { return ev.WmBase }
+func (ev XdgSurfaceConfigureEvent) Sender() any              { return ev.Surface }
+func (ev XdgToplevelConfigureEvent) Sender() any             { return ev.Toplevel }
+func (ev XdgToplevelCloseEvent) Sender() any                 { return ev.Toplevel }
+func (ev XdgToplevelConfigureBoundsEvent) Sender() any       { return ev.Toplevel }
+func (ev XdgToplevelWmCapabilitiesEvent) Sender() any        { return ev.Toplevel }
+func (ev XdgToplevelDecorationConfigureEvent) Sender() any   { return ev.Decoration }
+func (ev LinuxDmabufFormatEvent) Sender() any                { return ev.Dmabuf }
+func (ev LinuxDmabufModifierEvent) Sender() any              { return ev.Dmabuf }
+func (ev LinuxBufferParamsCreatedEvent) Sender() any         { return ev.Params }
+func (ev LinuxBufferParamsFailedEvent) Sender() any          { return ev.Params }
+func (ev LinuxDmabufFeedbackDoneEvent) Sender() any          { return ev.Feedback }
+func (ev WpFractionalScalePreferredScaleEvent) Sender() any  { return ev.FractionalScale }
+
+// fieldEvents maps events of proxies without internal handlers to their event types, so that
+// the dispatcher can construct them from the arguments of the On* fields.
+var fieldEvents = map[eventTypeKey]reflect.Type{}
+
+type eventTypeKey struct {
+	proxy reflect.Type
+	// name is the event's name in lower case, without underscores
+	name string
+}
+
+func init() {
+	for _, ev := range []Event{
+		BufferReleaseEvent{},
+		XdgWmBasePingEvent{},
+		XdgSurfaceConfigureEvent{},
+		XdgToplevelConfigureEvent{},
+		XdgToplevelCloseEvent{},
+		XdgToplevelConfigureBoundsEvent{},
+		XdgToplevelWmCapabilitiesEvent{},
+		XdgToplevelDecorationConfigureEvent{},
+	} {
+		typ := reflect.TypeOf(ev)
+		proxy := typ.Field(0).Type
+		name := strings.TrimSuffix(strings.TrimPrefix(typ.Name(), proxy.Elem().Name()), "Event")
+		fieldEvents[eventTypeKey{proxy, normalizeEventName(name)}] = typ
+	}
+}
+
+func normalizeEventName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// eventListener is where the events of a proxy go.
+type eventListener struct {
+	ch       chan<- Event
+	buffered bool
+	// subs are the subscriptions made with Subscribe, in registration order. The slice is
+	// copied on write so that subscriptions can be changed while delivering events.
+	subs []*subscription
+}
+
+type subscription struct {
+	fn func(Event)
+	// canceled is set when unsubscribing, which may happen while the subscription is being
+	// delivered to.
+	canceled atomic.Bool
+}
+
+func (l *eventListener) empty() bool {
+	return l.ch == nil && !l.buffered && len(l.subs) == 0
+}
+
+// Listen sends the events of proxy to ch, in addition to calling the proxy's On* fields.
+// Multiple proxies may share a channel. Events are sent from within the dispatch functions,
+// which block while ch is full. Slices in events are copies and remain valid after dispatch.
+func (dsp *Display) Listen(proxy any, ch chan<- Event) {
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	dsp.listener(proxy).ch = ch
+}
+
+// BufferEvents buffers the events of proxy, in addition to calling the proxy's On* fields,
+// so that they can be processed with Events after dispatching.
+func (dsp *Display) BufferEvents(proxy any) {
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	dsp.listener(proxy).buffered = true
+}
+
+// StopEvents stops the delivery of proxy's events set up by Listen and BufferEvents.
+// Subscriptions are unaffected. Destroying a proxy stops the delivery of its events
+// automatically.
+func (dsp *Display) StopEvents(proxy any) {
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	l, ok := dsp.listeners[proxy]
+	if !ok {
+		return
+	}
+	l.ch = nil
+	l.buffered = false
+	if l.empty() {
+		delete(dsp.listeners, proxy)
+	}
+}
+
+// Subscribe calls fn for every event of type E received by proxy, which must be the proxy
+// type the event belongs to. Subscribers are called after the proxy's On* field, in the order
+// they subscribed. The returned function cancels the subscription; it may be called from
+// within fn.
+//
+// Subscribe allows multiple, independent components to observe the same events, for
+// example:
+//
+//	unsub := Subscribe(dsp, top, func(ev XdgToplevelConfigureEvent) { ... })
+func Subscribe[E Event](dsp *Display, proxy any, fn func(E)) (unsubscribe func()) {
+	if want := reflect.TypeFor[E]().Field(0).Type; reflect.TypeOf(proxy) != want {
+		panic(fmt.Sprintf("can't subscribe to %s on %T, want %s", reflect.TypeFor[E](), proxy, want))
+	}
+	sub := &subscription{fn: func(ev Event) {
+		if ev, ok := ev.(E); ok {
+			fn(ev)
+		}
+	}}
+	dsp.mu.Lock()
+	l := dsp.listener(proxy)
+	l.subs = append(slices.Clip(l.subs), sub)
+	dsp.mu.Unlock()
+	return func() {
+		if sub.canceled.Swap(true) {
+			return
+		}
+		dsp.mu.Lock()
+		defer dsp.mu.Unlock()
+		l.subs = slices.DeleteFunc(slices.Clone(l.subs), func(s *subscription) bool { return s == sub })
+		if l.empty() && dsp.listeners[proxy] == l {
+			delete(dsp.listeners, proxy)
+		}
+	}
+}
+
+// listener returns the listener for proxy, creating it if necessary. dsp.mu must be held.
+func (dsp *Display) listener(proxy any) *eventListener {
+	if dsp.listeners == nil {
+		dsp.listeners = make(map[any]*eventListener)
+	}
+	l, ok := dsp.listeners[proxy]
+	if !ok {
+		l = &eventListener{}
+		dsp.listeners[proxy] = l
+	}
+	return l
+}
+
+// Events returns an iterator over the events buffered by BufferEvents, in the order they were
+// dispatched. Iterating removes the events from the buffer. A typical event loop dispatches
+// and then ranges over Events.
+func (dsp *Display) Events() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		for {
+			dsp.mu.Lock()
+			evs := dsp.buffered
+			dsp.buffered = nil
+			dsp.mu.Unlock()
+			if len(evs) == 0 {
+				return
+			}
+			for i, ev := range evs {
+				if !yield(ev) {
+					// Keep the events we haven't yielded yet, ahead of any that might've
+					// been buffered in the meantime.
+					dsp.mu.Lock()
+					dsp.buffered = append(evs[i+1:], dsp.buffered...)
+					dsp.mu.Unlock()
+					return
+				}
+			}
+		}
+	}
+}
+
+// observed reports whether events of proxy have to be delivered as values. It exists so that
+// we don't construct events nobody will see.
+func (dsp *Display) observed(proxy any) bool {
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	_, ok := dsp.listeners[proxy]
+	return ok
+}
+
+// deliver delivers an event of proxy to its listener.
+func (dsp *Display) deliver(proxy any, ev Event) {
+	dsp.mu.Lock()
+	l := dsp.listeners[proxy]
+	if l == nil {
+		dsp.mu.Unlock()
+		return
+	}
+	subs, ch := l.subs, l.ch
+	if l.buffered {
+		dsp.buffered = append(dsp.buffered, ev)
+	}
+	// Subscribers may subscribe and unsubscribe, and sending may block, so we mustn't hold
+	// the lock for the rest.
+	dsp.mu.Unlock()
+
+	for _, sub := range subs {
+		// An earlier subscriber may have canceled this subscription.
+		if !sub.canceled.Load() {
+			sub.fn(ev)
+		}
+	}
+	if ch != nil {
+		ch <- ev
+	}
+}
+
+// deliverField constructs and delivers the event of a proxy without an internal handler from
+// the arguments passed to its On* field.
+func (dsp *Display) deliverField(proxy any, name string, args []reflect.Value) {
+	typ, ok := fieldEvents[eventTypeKey{reflect.TypeOf(proxy), normalizeEventName(name)}]
+	if !ok {
+		return
+	}
+	ev := reflect.New(typ).Elem()
+	ev.Field(0).Set(reflect.ValueOf(proxy))
+	for i, arg := range args {
+		field := ev.Field(i + 1)
+		if arg.Kind() == reflect.Slice {
+			// Arrays point into libwayland's memory and are only valid during dispatch.
+			arg = reflect.AppendSlice(reflect.MakeSlice(arg.Type(), 0, arg.Len()), arg)
+		}
+		field.Set(arg.Convert(field.Type()))
+	}
+	dsp.deliver(proxy, ev.Interface().(Event))
+}
@@ -0,0 +1,157 @@
+package wayland
+
+import (
+	"slices"
+	"testing"
+)
+
+// sendGlobals sends a wl_registry.global event for each name.
+func sendGlobals(s *testServer, reg *Registry, names ...uint32) {
+	for _, name := range names {
+		s.send(reg.ID(), 0, name, "wl_output", uint32(1))
+	}
+}
+
+func TestSubscribeOrder(t *testing.T) {
+	s, dsp := newTestServer(t, nil)
+	reg := dsp.Registry()
+	roundtrip(t, dsp)
+
+	var got []string
+	reg.OnGlobal = func(uint32, string, uint32) { got = append(got, "field") }
+	Subscribe(dsp, reg, func(RegistryGlobalEvent) { got = append(got, "a") })
+	var unsubB, unsubC func()
+	unsubB = Subscribe(dsp, reg, func(RegistryGlobalEvent) {
+		got = append(got, "b")
+		// Unsubscribing from within a handler affects the event being delivered.
+		unsubB()
+		unsubC()
+	})
+	unsubC = Subscribe(dsp, reg, func(RegistryGlobalEvent) { got = append(got, "c") })
+	// Subscribers only see events of their type.
+	Subscribe(dsp, reg, func(RegistryGlobalRemoveEvent) { got = append(got, "remove") })
+
+	sendGlobals(s, reg, 1, 2)
+	roundtrip(t, dsp)
+	if want := []string{"field", "a", "b", "field", "a"}; !slices.Equal(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+	// Unsubscribing again is a no-op.
+	unsubB()
+}
+
+func TestSubscribeWrongProxy(t *testing.T) {
+	_, dsp := newTestServer(t, nil)
+	defer func() {
+		if recover() == nil {
+			t.Error("subscribing to another proxy type's event didn't panic")
+		}
+	}()
+	Subscribe(dsp, dsp.Registry(), func(CallbackDoneEvent) {})
+}
+
+func TestUnsubscribeForgetsListener(t *testing.T) {
+	_, dsp := newTestServer(t, nil)
+	reg := dsp.Registry()
+	unsub := Subscribe(dsp, reg, func(RegistryGlobalEvent) {})
+	if !dsp.observed(reg) {
+		t.Fatal("registry isn't observed after subscribing")
+	}
+	unsub()
+	if dsp.observed(reg) {
+		t.Error("registry is still observed after unsubscribing")
+	}
+}
+
+// globalNames returns the names of the RegistryGlobalEvents in evs.
+func globalNames(t *testing.T, evs []Event) []uint32 {
+	t.Helper()
+	var names []uint32
+	for _, ev := range evs {
+		g, ok := ev.(RegistryGlobalEvent)
+		if !ok {
+			t.Fatalf("got event %T, want RegistryGlobalEvent", ev)
+		}
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+func TestEventsBreak(t *testing.T) {
+	s, dsp := newTestServer(t, nil)
+	reg := dsp.Registry()
+	roundtrip(t, dsp)
+	dsp.BufferEvents(reg)
+
+	sendGlobals(s, reg, 1, 2, 3)
+	roundtrip(t, dsp)
+	for ev := range dsp.Events() {
+		if name := ev.(RegistryGlobalEvent).Name; name != 1 {
+			t.Errorf("got global %d first, want 1", name)
+		}
+		break
+	}
+	// The remaining events come before the ones buffered afterwards.
+	sendGlobals(s, reg, 4)
+	roundtrip(t, dsp)
+	if got, want := globalNames(t, slices.Collect(dsp.Events())), []uint32{2, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("got globals %v, want %v", got, want)
+	}
+	if got := slices.Collect(dsp.Events()); len(got) != 0 {
+		t.Errorf("got %d events after draining the buffer", len(got))
+	}
+}
+
+func TestDeliverFieldCopiesSlices(t *testing.T) {
+	s, dsp := newTestServer(t, nil, testGlobal{1, "wl_compositor", 6}, testGlobal{2, "xdg_wm_base", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	xdg := bindGlobal[*XdgWmBase](t, dsp, 2, 1)
+	top := xdg.XdgSurface(comp.CreateSurface()).Toplevel()
+
+	var field []uint32
+	top.OnConfigure = func(width, height int32, states []uint32) { field = states }
+	ch := make(chan Event, 1)
+	dsp.Listen(top, ch)
+	s.send(top.ID(), 0, int32(800), int32(600), indices(1, 0, 4, 0))
+	roundtrip(t, dsp)
+
+	ev := (<-ch).(XdgToplevelConfigureEvent)
+	if ev.Toplevel != top || ev.Width != 800 || ev.Height != 600 {
+		t.Errorf("got event %+v", ev)
+	}
+	if !slices.Equal(ev.States, []uint32{1, 4}) {
+		t.Errorf("got states %v, want [1 4]", ev.States)
+	}
+	if len(field) == 0 || &field[0] == &ev.States[0] {
+		t.Error("event shares its states with the array passed to OnConfigure")
+	}
+}
+
+func TestStopEvents(t *testing.T) {
+	s, dsp := newTestServer(t, nil)
+	reg := dsp.Registry()
+	roundtrip(t, dsp)
+	// Stopping the events of a proxy that has no listener is a no-op.
+	dsp.StopEvents(reg)
+
+	ch := make(chan Event, 2)
+	dsp.Listen(reg, ch)
+	dsp.BufferEvents(reg)
+	var subscribed int
+	Subscribe(dsp, reg, func(RegistryGlobalEvent) { subscribed++ })
+	sendGlobals(s, reg, 1)
+	roundtrip(t, dsp)
+
+	dsp.StopEvents(reg)
+	sendGlobals(s, reg, 2)
+	roundtrip(t, dsp)
+	if got := globalNames(t, slices.Collect(dsp.Events())); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("got buffered globals %v, want [1]", got)
+	}
+	if len(ch) != 1 {
+		t.Errorf("got %d events on the channel, want 1", len(ch))
+	}
+	if subscribed != 2 {
+		t.Errorf("subscriber was called %d times, want 2", subscribed)
+	}
+}
@@ -0,0 +1,180 @@
+package wayland
+
+// #include <wayland-client.h>
+// #include "fractional-scale-v1-client-protocol.h"
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+var WpFractionalScaleManagerV1Interface = &C.wp_fractional_scale_manager_v1_interface
+
+// FractionalScaleDenominator is the denominator of scales sent by wp_fractional_scale_v1.
+const FractionalScaleDenominator = 120
+
+func (reg *Registry) BindWpFractionalScaleManagerV1(name uint32, vers uint32) *WpFractionalScaleManager {
+	vers = clampVersion(WpFractionalScaleManagerV1Interface, vers)
+	defer creating(reg)()
+	out := &WpFractionalScaleManager{
+		dsp:  reg.dsp,
+		hnd:  (*C.struct_wp_fractional_scale_manager_v1)(reg.bind(name, WpFractionalScaleManagerV1Interface, vers)),
+		vers: int(vers),
+	}
+	reg.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
+	return out
+}
+
+type WpFractionalScaleManager struct {
+	dsp  *Display
+	hnd  *C.struct_wp_fractional_scale_manager_v1
+	id   uint32
+	vers int
+}
+
+func (mgr *WpFractionalScaleManager) Version() int           { return mgr.vers }
+func (mgr *WpFractionalScaleManager) ID() uint32             { return proxyID(unsafe.Pointer(mgr.hnd), mgr.id) }
+func (mgr *WpFractionalScaleManager) Interface() string      { return "wp_fractional_scale_manager_v1" }
+func (mgr *WpFractionalScaleManager) Handle() unsafe.Pointer { return unsafe.Pointer(mgr.hnd) }
+func (mgr *WpFractionalScaleManager) display() *Display      { return mgr.dsp }
+
+// FractionalScale creates a wp_fractional_scale_v1 object for surf. A surface can have at
+// most one such object.
+func (mgr *WpFractionalScaleManager) FractionalScale(surf *Surface) *WpFractionalScale {
+	checkLive(mgr)
+	defer creating(mgr)()
+	checkLive(surf)
+	out := &WpFractionalScale{
+		dsp:  mgr.dsp,
+		hnd:  C.wp_fractional_scale_manager_v1_get_fractional_scale(mgr.hnd, surf.hnd),
+		vers: mgr.vers,
+	}
+	mgr.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
+	if mgr.dsp.traced(mgr) {
+		mgr.dsp.traceRequest(mgr, "get_fractional_scale", out, surf)
+	}
+	return out
+}
+
+func (mgr *WpFractionalScaleManager) Destroy() {
+	if mgr.hnd == nil {
+		mgr.dsp.destroyedTwice(mgr)
+		return
+	}
+	mgr.id = mgr.ID()
+	if mgr.dsp.traced(mgr) {
+		mgr.dsp.traceRequest(mgr, "destroy")
+	}
+	mgr.dsp.forget((*C.struct_wl_proxy)(mgr.hnd))
+	C.wp_fractional_scale_manager_v1_destroy(mgr.hnd)
+	mgr.hnd = nil
+}
+
+type WpFractionalScale struct {
+	dsp  *Display
+	hnd  *C.struct_wp_fractional_scale_v1
+	id   uint32
+	vers int
+	// scale is the most recent preferred scale, in 120ths. It is protected by dsp.mu, as
+	// ScaleTracker may read it while dispatching other queues.
+	scale uint32
+
+	// OnPreferred_scale is called with the scale the compositor would like the surface to be
+	// rendered at, such as 1.25 or 1.5.
+	OnPreferred_scale func(scale float64)
+}
+
+type wpFractionalScale WpFractionalScale
+
+func (fs *WpFractionalScale) internal() any {
+	return (*wpFractionalScale)(fs)
+}
+
+func (fs *wpFractionalScale) Preferred_scale(scale uint32) {
+	fs.dsp.mu.Lock()
+	fs.scale = scale
+	fs.dsp.mu.Unlock()
+	f := float64(scale) / FractionalScaleDenominator
+	if fs.OnPreferred_scale != nil {
+		fs.OnPreferred_scale(f)
+	}
+	if fs.dsp.observed((*WpFractionalScale)(fs)) {
+		fs.dsp.deliver((*WpFractionalScale)(fs), WpFractionalScalePreferredScaleEvent{(*WpFractionalScale)(fs), f})
+	}
+}
+
+func (fs *WpFractionalScale) Version() int           { return fs.vers }
+func (fs *WpFractionalScale) ID() uint32             { return proxyID(unsafe.Pointer(fs.hnd), fs.id) }
+func (fs *WpFractionalScale) Interface() string      { return "wp_fractional_scale_v1" }
+func (fs *WpFractionalScale) Handle() unsafe.Pointer { return unsafe.Pointer(fs.hnd) }
+func (fs *WpFractionalScale) display() *Display      { return fs.dsp }
+
+// Scale returns the most recent preferred scale, or 0 if the compositor hasn't sent one yet.
+func (fs *WpFractionalScale) Scale() float64 {
+	fs.dsp.mu.Lock()
+	defer fs.dsp.mu.Unlock()
+	return float64(fs.scale) / FractionalScaleDenominator
+}
+
+func (fs *WpFractionalScale) Destroy() {
+	if fs.hnd == nil {
+		fs.dsp.destroyedTwice(fs)
+		return
+	}
+	fs.id = fs.ID()
+	if fs.dsp.traced(fs) {
+		fs.dsp.traceRequest(fs, "destroy")
+	}
+	fs.dsp.forget((*C.struct_wl_proxy)(fs.hnd))
+	C.wp_fractional_scale_v1_destroy(fs.hnd)
+	fs.hnd = nil
+}
+
+// ScaledSize describes how to render a surface at a fractional scale: a buffer of size
+// BufferWidth×BufferHeight is attached with a buffer scale of 1 and mapped to the
+// surface-local size DestWidth×DestHeight with WpViewport.SetDestination.
+type ScaledSize struct {
+	BufferWidth, BufferHeight int
+	DestWidth, DestHeight     int
+}
+
+// ScaleSize computes the buffer size and viewport destination for a surface of the given
+// logical size, rendered at scale. Like compositors do for toplevel surfaces, the buffer size
+// is rounded half away from zero.
+func ScaleSize(width, height int, scale float64) ScaledSize {
+	return ScaledSize{
+		BufferWidth:  scaleDim(width, scale),
+		BufferHeight: scaleDim(height, scale),
+		DestWidth:    width,
+		DestHeight:   height,
+	}
+}
+
+// Apply sets the viewport's destination and unsets its source, so that the whole buffer is
+// mapped to the logical size. The size must be positive, or the server would raise a
+// protocol error; Apply returns an error instead of sending it.
+func (sz ScaledSize) Apply(port *WpViewport) error {
+	if sz.DestWidth <= 0 || sz.DestHeight <= 0 {
+		return fmt.Errorf("invalid viewport destination size %dx%d", sz.DestWidth, sz.DestHeight)
+	}
+	port.UnsetSource()
+	port.SetDestination(sz.DestWidth, sz.DestHeight)
+	return nil
+}
+
+func scaleDim(v int, scale float64) int {
+	// Scales reported by the compositor are multiples of 1/120, which aren't exactly
+	// representable as floats. Compute with integers where possible so that we round the
+	// same way as the compositor does.
+	n := scale * FractionalScaleDenominator
+	if r := math.Round(n); math.Abs(n-r) < 1e-6 {
+		num := v * int(r)
+		if num < 0 {
+			return -((-num + FractionalScaleDenominator/2) / FractionalScaleDenominator)
+		}
+		return (num + FractionalScaleDenominator/2) / FractionalScaleDenominator
+	}
+	return int(math.Round(float64(v) * scale))
+}
@@ -0,0 +1,80 @@
+package wayland
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestScaleSize(t *testing.T) {
+	for _, tt := range []struct {
+		size  int
+		scale float64
+		want  int
+	}{
+		{0, 1.25, 0},
+		{1, 1.25, 1},
+		{2, 1.25, 3},
+		{3, 1.25, 4},
+		{5, 1.25, 6},
+		{6, 1.25, 8},
+		{7, 1.25, 9},
+		{101, 1.25, 126},
+		{1, 1.5, 2},
+		{3, 1.5, 5},
+		{5, 1.5, 8},
+		{7, 1.5, 11},
+		{101, 1.5, 152},
+		// Half away from zero.
+		{-3, 1.5, -5},
+		{-2, 1.25, -3},
+		{7, 1, 7},
+		{7, 2, 14},
+		// 30 * 2.05 is slightly less than 61.5 in floating point, but exactly 61.5 in 120ths.
+		{30, 2.05, 62},
+		// Scales that aren't multiples of 1/120 are rounded in floating point.
+		{3, 1.001, 3},
+	} {
+		got := ScaleSize(tt.size, tt.size, tt.scale)
+		if got != (ScaledSize{tt.want, tt.want, tt.size, tt.size}) {
+			t.Errorf("ScaleSize(%d, %d, %g) = %+v, want a buffer size of %d", tt.size, tt.size, tt.scale, got, tt.want)
+		}
+	}
+	if got, want := ScaleSize(5, 3, 1.5), (ScaledSize{8, 5, 5, 3}); got != want {
+		t.Errorf("ScaleSize(5, 3, 1.5) = %+v, want %+v", got, want)
+	}
+}
+
+func TestScaledSizeApply(t *testing.T) {
+	var requests atomic.Int32
+	_, dsp := newTestServer(t, func(s *testServer, req testRequest) {
+		requests.Add(1)
+	}, testGlobal{1, "wl_compositor", 6}, testGlobal{2, "wp_viewporter", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	porter := bindGlobal[*WpViewporter](t, dsp, 2, 1)
+	port := porter.Viewport(comp.CreateSurface())
+	roundtrip(t, dsp)
+
+	for _, sz := range []ScaledSize{
+		ScaleSize(0, 10, 1.5),
+		ScaleSize(10, 0, 1.5),
+		ScaleSize(-1, -1, 1.5),
+	} {
+		requests.Store(0)
+		if err := sz.Apply(port); err == nil {
+			t.Errorf("Apply accepted a destination size of %dx%d", sz.DestWidth, sz.DestHeight)
+		}
+		roundtrip(t, dsp)
+		if n := requests.Load(); n != 0 {
+			t.Errorf("Apply sent %d requests for a destination size of %dx%d", n, sz.DestWidth, sz.DestHeight)
+		}
+	}
+	requests.Store(0)
+	if err := ScaleSize(10, 10, 1.5).Apply(port); err != nil {
+		t.Fatal(err)
+	}
+	roundtrip(t, dsp)
+	// unset_source and set_destination
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Apply sent %d requests, want 2", n)
+	}
+}
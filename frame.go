@@ -0,0 +1,82 @@
+package wayland
+
+import (
+	"slices"
+	"time"
+)
+
+// FrameRequest is a request for a frame callback, created by Surface.RequestFrame.
+type FrameRequest struct {
+	fc *frameCallback
+	fn func(timestamp time.Duration)
+}
+
+// frameCallback is a wl_callback shared by the frame requests made between two commits.
+type frameCallback struct {
+	surf *Surface
+	cb   *Callback
+	// reqs are the requests that haven't been canceled. It is protected by surf.frameMu.
+	reqs []*FrameRequest
+}
+
+// RequestFrame requests a frame callback for the next commit. fn is called with the
+// callback's timestamp once the compositor is ready for a new frame. The timestamp has
+// millisecond granularity and an undefined base, so it's only useful for computing
+// differences between frames.
+//
+// Requests made between two commits share a single wl_callback, so calling RequestFrame
+// repeatedly, for example from independent parts of an application, doesn't create
+// redundant callbacks. Each fn is called once, in the order of the requests.
+func (surf *Surface) RequestFrame(fn func(timestamp time.Duration)) *FrameRequest {
+	checkLive(surf)
+	surf.frameMu.Lock()
+	defer surf.frameMu.Unlock()
+	fc := surf.frame
+	if fc == nil {
+		fc = &frameCallback{surf: surf}
+		fc.cb = surf.Frame(fc.done)
+		surf.frame = fc
+	}
+	r := &FrameRequest{fc: fc, fn: fn}
+	fc.reqs = append(fc.reqs, r)
+	return r
+}
+
+func (fc *frameCallback) done(data uint32) {
+	fc.surf.frameMu.Lock()
+	reqs := fc.reqs
+	fc.reqs = nil
+	if fc.surf.frame == fc {
+		fc.surf.frame = nil
+	}
+	fc.surf.frameMu.Unlock()
+	ts := time.Duration(data) * time.Millisecond
+	for _, r := range reqs {
+		if r.fn != nil {
+			r.fn(ts)
+		}
+	}
+}
+
+// Cancel cancels the request, so that its function won't be called. Once all requests
+// sharing a wl_callback have been canceled, the callback is destroyed. Canceling a request
+// that has already completed has no effect.
+func (r *FrameRequest) Cancel() {
+	fc := r.fc
+	// Holding the lock while destroying the callback orders Cancel with the done event
+	// being dispatched concurrently: either done takes the requests first and Cancel finds
+	// nothing to do, or the callback is destroyed and done finds no requests.
+	fc.surf.frameMu.Lock()
+	defer fc.surf.frameMu.Unlock()
+	i := slices.Index(fc.reqs, r)
+	if i == -1 {
+		return
+	}
+	fc.reqs = slices.Delete(fc.reqs, i, i+1)
+	if len(fc.reqs) == 0 {
+		if fc.surf.frame == fc {
+			fc.surf.frame = nil
+		}
+		fc.cb.Destroy()
+	}
+}
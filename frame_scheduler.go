@@ -0,0 +1,257 @@
+package wayland
+
+// #include <time.h>
+import "C"
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// FrameScheduler paces the rendering of a surface. It combines frame callbacks, which tell us
+// when the compositor is ready for a new frame, with presentation feedback, which tells us
+// when frames actually hit the screen, to predict the next vertical blank and to decide when
+// rendering has to start to make it.
+//
+// Instead of calling Surface.Commit, the application calls FrameScheduler.Commit, which
+// requests a frame callback and presentation feedback for the content update. Once the
+// compositor is ready for the next frame, OnFrame is called with the timing of the next
+// frame.
+//
+// All times are in the domain of the presentation clock (see WpPresentation.Clock), which has
+// to be known before the scheduler is created.
+type FrameScheduler struct {
+	surf *Surface
+	pres *WpPresentation
+
+	// OnFrame is called when the compositor is ready for a new frame. Rendering should start
+	// at timing.StartAt to be presented at timing.Target.
+	OnFrame func(timing FrameTiming)
+
+	// Margin is added to the estimated render time to absorb variance in rendering and
+	// scheduling. It defaults to one millisecond.
+	Margin time.Duration
+
+	// the most recent presentation
+	lastPresent time.Duration
+	refresh     time.Duration
+
+	// renderTime is a moving average of the time between starting to render and committing.
+	renderTime time.Duration
+	// the timing handed out by the most recent call of OnFrame, or the zero value
+	timing    FrameTiming
+	delivered time.Duration
+
+	frame *FrameRequest
+	stats FrameStats
+	// state for computing the mean and standard deviation of presentation errors
+	errMean, errM2 float64
+	latencySum     time.Duration
+}
+
+// FrameTiming describes the predicted timing of the next frame.
+type FrameTiming struct {
+	// Target is the predicted presentation time of the frame.
+	Target time.Duration
+	// StartAt is the time at which rendering should start to meet Target, based on the
+	// estimated render time.
+	StartAt time.Duration
+	// Refresh is the output's refresh interval, or zero if unknown.
+	Refresh time.Duration
+}
+
+// FrameStats are statistics collected by a FrameScheduler.
+type FrameStats struct {
+	// Committed is the number of frames committed via the scheduler.
+	Committed uint64
+	// Presented and Discarded count frames by their outcome.
+	Presented uint64
+	Discarded uint64
+	// Missed is the number of presented frames that were displayed one or more refresh
+	// cycles after their target.
+	Missed uint64
+	// Latency is the mean time between committing a frame and its presentation.
+	Latency time.Duration
+	// Jitter is the standard deviation of the difference between frames' target and actual
+	// presentation times.
+	Jitter time.Duration
+	// RenderTime is the current estimate of the time it takes to render a frame.
+	RenderTime time.Duration
+	// Refresh is the most recently reported refresh interval.
+	Refresh time.Duration
+}
+
+// NewFrameScheduler returns a scheduler for surf. It returns an error if pres hasn't received
+// the presentation clock yet, which the compositor sends right after binding; a roundtrip
+// after binding is enough to wait for it.
+func NewFrameScheduler(surf *Surface, pres *WpPresentation) (*FrameScheduler, error) {
+	if !pres.hasClock {
+		return nil, errors.New("presentation clock isn't known yet")
+	}
+	return &FrameScheduler{
+		surf:   surf,
+		pres:   pres,
+		Margin: time.Millisecond,
+	}, nil
+}
+
+// Now returns the current time of the presentation clock.
+func (s *FrameScheduler) Now() time.Duration {
+	return clockNow(s.pres.Clock())
+}
+
+// NextFrame predicts the timing of the next frame if rendering were to start now.
+func (s *FrameScheduler) NextFrame() FrameTiming {
+	return s.nextFrame(s.Now())
+}
+
+func (s *FrameScheduler) nextFrame(now time.Duration) FrameTiming {
+	budget := s.renderTime + s.Margin
+	target := s.predict(now + budget)
+	return FrameTiming{
+		Target:  target,
+		StartAt: max(now, target-budget),
+		Refresh: s.refresh,
+	}
+}
+
+// predict returns the first predicted vertical blank at or after t. Without a constant
+// refresh rate, we cannot do better than t itself.
+func (s *FrameScheduler) predict(t time.Duration) time.Duration {
+	if s.refresh <= 0 || s.lastPresent == 0 {
+		return t
+	}
+	if t <= s.lastPresent {
+		return s.lastPresent
+	}
+	n := (t - s.lastPresent + s.refresh - 1) / s.refresh
+	return s.lastPresent + n*s.refresh
+}
+
+// Commit requests a frame callback and presentation feedback for the pending state of the
+// surface, and commits it.
+func (s *FrameScheduler) Commit() {
+	now := s.Now()
+	timing := s.committed(now)
+
+	if s.frame == nil {
+		s.frame = s.surf.RequestFrame(s.frameDone)
+	}
+	fb := s.pres.Feedback(s.surf)
+	fb.OnPresented = func(info PresentationInfo) { s.presented(now, timing, info) }
+	fb.OnDiscarded = func() { s.stats.Discarded++ }
+	s.stats.Committed++
+	s.surf.Commit()
+}
+
+// committed returns the timing of the frame committed at now and updates the render time
+// estimate.
+func (s *FrameScheduler) committed(now time.Duration) FrameTiming {
+	timing := s.timing
+	s.timing = FrameTiming{}
+	if timing.Target == 0 {
+		// The application didn't render in response to OnFrame, for example for the
+		// first frame.
+		return s.nextFrame(now)
+	}
+	d := now - max(s.delivered, timing.StartAt)
+	if d > s.maxRenderTime() {
+		// The application didn't render in response to OnFrame either, but resumed after
+		// being idle, which says nothing about how long rendering takes.
+		return s.nextFrame(now)
+	}
+	if d > 0 {
+		s.updateRenderTime(d)
+	}
+	return timing
+}
+
+// defaultRefresh is the refresh interval assumed while the output's is unknown.
+const defaultRefresh = time.Second / 60
+
+// maxRenderTime returns how long after the start of a frame a commit still counts as having
+// rendered that frame: a few refresh cycles, or more if rendering is already known to be
+// slow.
+func (s *FrameScheduler) maxRenderTime() time.Duration {
+	refresh := s.refresh
+	if refresh <= 0 {
+		refresh = defaultRefresh
+	}
+	return max(4*refresh, 2*s.renderTime)
+}
+
+func (s *FrameScheduler) frameDone(time.Duration) {
+	s.frame = nil
+	s.delivered = s.Now()
+	s.timing = s.nextFrame(s.delivered)
+	if s.OnFrame != nil {
+		s.OnFrame(s.timing)
+	}
+}
+
+func (s *FrameScheduler) presented(committed time.Duration, timing FrameTiming, info PresentationInfo) {
+	s.stats.Presented++
+	if info.Refresh > 0 {
+		s.refresh = info.Refresh
+	}
+	if info.Timestamp > s.lastPresent {
+		s.lastPresent = info.Timestamp
+	}
+
+	if s.refresh > 0 && info.Timestamp-timing.Target > s.refresh/2 {
+		s.stats.Missed++
+	}
+	s.latencySum += info.Timestamp - committed
+
+	// Welford's online algorithm
+	e := float64(info.Timestamp - timing.Target)
+	n := float64(s.stats.Presented)
+	delta := e - s.errMean
+	s.errMean += delta / n
+	s.errM2 += delta * (e - s.errMean)
+}
+
+func (s *FrameScheduler) updateRenderTime(d time.Duration) {
+	if s.renderTime == 0 {
+		s.renderTime = d
+		return
+	}
+	// Exponential moving average that reacts to increases faster than to decreases, as
+	// underestimating the render time costs us frames.
+	if d > s.renderTime {
+		s.renderTime += (d - s.renderTime) / 2
+	} else {
+		s.renderTime += (d - s.renderTime) / 8
+	}
+}
+
+// Stats returns statistics about the frames committed so far.
+func (s *FrameScheduler) Stats() FrameStats {
+	stats := s.stats
+	stats.RenderTime = s.renderTime
+	stats.Refresh = s.refresh
+	if stats.Presented > 0 {
+		stats.Latency = s.latencySum / time.Duration(stats.Presented)
+	}
+	if stats.Presented > 1 {
+		stats.Jitter = time.Duration(math.Sqrt(s.errM2 / float64(stats.Presented-1)))
+	}
+	return stats
+}
+
+// Destroy cancels the pending frame callback, if any. Presentation feedback for frames that
+// have already been committed is still collected.
+func (s *FrameScheduler) Destroy() {
+	if s.frame != nil {
+		s.frame.Cancel()
+		s.frame = nil
+	}
+}
+
+// clockNow returns the current time of the clock_gettime clock with the given ID.
+func clockNow(clock uint32) time.Duration {
+	var ts C.struct_timespec
+	C.clock_gettime(C.clockid_t(clock), &ts)
+	return time.Duration(ts.tv_sec)*time.Second + time.Duration(ts.tv_nsec)
+}
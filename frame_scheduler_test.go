@@ -0,0 +1,171 @@
+package wayland
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const ms = time.Millisecond
+
+func TestFrameSchedulerPredict(t *testing.T) {
+	tests := []struct {
+		refresh, last, t time.Duration
+		want             time.Duration
+	}{
+		{0, 100 * ms, 120 * ms, 120 * ms},           // unknown refresh rate
+		{16 * ms, 0, 120 * ms, 120 * ms},            // nothing presented yet
+		{16 * ms, 100 * ms, 90 * ms, 100 * ms},      // before the last presentation
+		{16 * ms, 100 * ms, 100 * ms, 100 * ms},     // at the last presentation
+		{16 * ms, 100 * ms, 101 * ms, 116 * ms},     // right after it
+		{16 * ms, 100 * ms, 116 * ms, 116 * ms},     // exactly on a vblank
+		{16 * ms, 100 * ms, 140 * ms, 148 * ms},     // a few cycles later
+		{16 * ms, 100 * ms, 1100 * ms, 1108 * ms},   // long after
+		{16 * ms, 100 * ms, 1108*ms + 1, 1124 * ms}, // just past a vblank
+	}
+	for _, tt := range tests {
+		s := &FrameScheduler{refresh: tt.refresh, lastPresent: tt.last}
+		if got := s.predict(tt.t); got != tt.want {
+			t.Errorf("refresh %v, last %v: predict(%v) = %v, want %v", tt.refresh, tt.last, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestFrameSchedulerNextFrame(t *testing.T) {
+	tests := []struct {
+		renderTime, now time.Duration
+		want            FrameTiming
+	}{
+		// The next vblank leaves enough time, so rendering can be delayed.
+		{2 * ms, 101 * ms, FrameTiming{Target: 116 * ms, StartAt: 113 * ms, Refresh: 16 * ms}},
+		// Rendering has to start now.
+		{5 * ms, 110 * ms, FrameTiming{Target: 116 * ms, StartAt: 110 * ms, Refresh: 16 * ms}},
+		// The next vblank is too close.
+		{5 * ms, 112 * ms, FrameTiming{Target: 132 * ms, StartAt: 126 * ms, Refresh: 16 * ms}},
+	}
+	for _, tt := range tests {
+		s := &FrameScheduler{Margin: ms, refresh: 16 * ms, lastPresent: 100 * ms, renderTime: tt.renderTime}
+		if got := s.nextFrame(tt.now); got != tt.want {
+			t.Errorf("render time %v: nextFrame(%v) = %+v, want %+v", tt.renderTime, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestFrameSchedulerUpdateRenderTime(t *testing.T) {
+	var s FrameScheduler
+	for i, step := range []struct{ sample, want time.Duration }{
+		{8 * ms, 8 * ms},   // the first sample is taken as is
+		{16 * ms, 12 * ms}, // increases are followed quickly
+		{4 * ms, 11 * ms},  // decreases slowly
+		{11 * ms, 11 * ms},
+	} {
+		s.updateRenderTime(step.sample)
+		if s.renderTime != step.want {
+			t.Fatalf("step %d: render time is %v after sample %v, want %v", i, s.renderTime, step.sample, step.want)
+		}
+	}
+}
+
+func TestFrameSchedulerCommitted(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      time.Duration // between the frame's start and the commit
+		renderTime time.Duration // the resulting estimate
+		stale      bool          // whether the commit gets a new timing
+	}{
+		{"render", 6 * ms, 5 * ms, false},
+		{"slow render", 40 * ms, 22 * ms, false},
+		{"after idling", 3 * time.Second, 4 * ms, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &FrameScheduler{Margin: ms, refresh: 16 * ms, lastPresent: 100 * ms, renderTime: 4 * ms}
+			s.delivered = 101 * ms
+			s.timing = s.nextFrame(s.delivered)
+			frame := s.timing
+			now := frame.StartAt + tt.delay
+			got := s.committed(now)
+			if s.renderTime != tt.renderTime {
+				t.Errorf("render time is %v, want %v", s.renderTime, tt.renderTime)
+			}
+			if tt.stale {
+				if got != s.nextFrame(now) {
+					t.Errorf("got timing %+v for a stale frame, want %+v", got, s.nextFrame(now))
+				}
+			} else if got != frame {
+				t.Errorf("got timing %+v, want the frame's %+v", got, frame)
+			}
+			if s.timing != (FrameTiming{}) {
+				t.Error("timing of the frame wasn't reset")
+			}
+		})
+	}
+
+	// Without OnFrame, there is nothing to measure.
+	s := &FrameScheduler{Margin: ms, renderTime: 4 * ms}
+	if got := s.committed(50 * ms); got != s.nextFrame(50*ms) || s.renderTime != 4*ms {
+		t.Errorf("got timing %+v and render time %v without a frame callback", got, s.renderTime)
+	}
+}
+
+func TestFrameSchedulerStats(t *testing.T) {
+	s := &FrameScheduler{renderTime: 3 * ms}
+	frames := []struct {
+		committed, target time.Duration
+		info              PresentationInfo
+	}{
+		{90 * ms, 100 * ms, PresentationInfo{Timestamp: 100 * ms, Refresh: 16 * ms}},
+		// Missed by one cycle.
+		{110 * ms, 116 * ms, PresentationInfo{Timestamp: 132 * ms, Refresh: 16 * ms}},
+		// Late by less than half a cycle, which doesn't count as missed.
+		{140 * ms, 148 * ms, PresentationInfo{Timestamp: 155 * ms}},
+	}
+	var errs []float64
+	var latency time.Duration
+	for _, f := range frames {
+		s.presented(f.committed, FrameTiming{Target: f.target}, f.info)
+		errs = append(errs, float64(f.info.Timestamp-f.target))
+		latency += f.info.Timestamp - f.committed
+	}
+	var mean, sq float64
+	for _, e := range errs {
+		mean += e / float64(len(errs))
+	}
+	for _, e := range errs {
+		sq += (e - mean) * (e - mean)
+	}
+	jitter := time.Duration(math.Sqrt(sq / float64(len(errs)-1)))
+
+	stats := s.Stats()
+	if stats.Presented != 3 || stats.Missed != 1 {
+		t.Errorf("got %d presented and %d missed frames, want 3 and 1", stats.Presented, stats.Missed)
+	}
+	if want := latency / 3; stats.Latency != want {
+		t.Errorf("got latency %v, want %v", stats.Latency, want)
+	}
+	if d := stats.Jitter - jitter; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("got jitter %v, want %v", stats.Jitter, jitter)
+	}
+	if stats.Refresh != 16*ms || stats.RenderTime != 3*ms {
+		t.Errorf("got refresh %v and render time %v, want 16ms and 3ms", stats.Refresh, stats.RenderTime)
+	}
+	if s.lastPresent != 155*ms {
+		t.Errorf("last presentation is %v, want 155ms", s.lastPresent)
+	}
+}
+
+func TestNewFrameSchedulerClock(t *testing.T) {
+	s, dsp := newTestServer(t, nil, testGlobal{1, "wl_compositor", 4}, testGlobal{2, "wp_presentation", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 4)
+	pres := bindGlobal[*WpPresentation](t, dsp, 2, 1)
+	surf := comp.CreateSurface()
+	if _, err := NewFrameScheduler(surf, pres); err == nil {
+		t.Error("NewFrameScheduler accepted an unknown clock")
+	}
+	// CLOCK_REALTIME is 0, so the clock's ID doesn't tell whether it has been received.
+	s.send(pres.ID(), 0, uint32(0))
+	roundtrip(t, dsp)
+	if _, err := NewFrameScheduler(surf, pres); err != nil {
+		t.Error(err)
+	}
+}
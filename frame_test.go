@@ -0,0 +1,69 @@
+package wayland
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrameRequestCancel(t *testing.T) {
+	dsp, surf := newTestSurface(t)
+	dsp.StrictDestroy = true
+
+	var got []int
+	r1 := surf.RequestFrame(func(time.Duration) { got = append(got, 1) })
+	surf.RequestFrame(func(time.Duration) { got = append(got, 2) })
+	r1.Cancel()
+	roundtrip(t, dsp)
+	if len(got) != 1 || got[0] != 2 {
+		t.Errorf("got calls %v, want [2]", got)
+	}
+	// Canceling a completed request has no effect.
+	r1.Cancel()
+
+	// Canceling all requests destroys the shared callback.
+	got = nil
+	r1 = surf.RequestFrame(func(time.Duration) { got = append(got, 1) })
+	r2 := surf.RequestFrame(func(time.Duration) { got = append(got, 2) })
+	r1.Cancel()
+	r2.Cancel()
+	roundtrip(t, dsp)
+	if len(got) != 0 {
+		t.Errorf("canceled requests were called: %v", got)
+	}
+	if n := dsp.LiveProxies()["wl_callback"]; n != 0 {
+		t.Errorf("%d callbacks leaked", n)
+	}
+}
+
+func TestFrameRequestCancelConcurrent(t *testing.T) {
+	// Cancel races with the dispatcher delivering the done event. Run with -race.
+	dsp, comp := newTestCompositor(t)
+	dsp.StrictDestroy = true
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error)
+	go func() { ran <- dsp.Run(ctx) }()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			surf := comp.CreateSurface()
+			defer surf.Destroy()
+			for range 200 {
+				surf.RequestFrame(func(time.Duration) {}).Cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	if err := <-ran; err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+	roundtrip(t, dsp)
+	if n := dsp.LiveProxies()["wl_callback"]; n != 0 {
+		t.Errorf("%d callbacks leaked", n)
+	}
+}
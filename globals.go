@@ -0,0 +1,143 @@
+package wayland
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// Global is a global advertised by the server.
+type Global struct {
+	Name      uint32
+	Interface string
+	Version   uint32
+	// Proxy is the bound object, or nil if the global hasn't been bound.
+	Proxy Proxy
+}
+
+// Globals keeps track of the globals advertised by the server and binds the interfaces the
+// client is interested in. It handles globals that come and go while the client is running,
+// such as outputs being plugged and unplugged.
+//
+// The state of Globals belongs to whoever dispatches the default queue, like that of any
+// other proxy.
+type Globals struct {
+	reg     *Registry
+	want    map[string]uint32
+	globals map[uint32]*Global
+
+	// OnAdd is called after a global has been added, and bound if requested. It isn't called
+	// for the globals collected by NewGlobals; use All for those.
+	OnAdd func(g *Global)
+	// OnRemove is called when a global has been removed, before its proxy gets destroyed.
+	OnRemove func(g *Global)
+}
+
+// NewGlobals creates a registry, binds the globals whose interfaces are in want, and does a
+// roundtrip to collect the initial set of globals. want maps interface names to the highest
+// version to bind, with 0 meaning the highest version supported by this package. The version
+// actually bound is negotiated with the server's; see Registry.BindGlobal.
+func NewGlobals(dsp *Display, want map[string]uint32) (*Globals, error) {
+	for iface := range want {
+		if _, ok := InterfaceVersion(iface); !ok {
+			return nil, fmt.Errorf("unsupported interface %q", iface)
+		}
+	}
+	g := &Globals{
+		reg:     dsp.Registry(),
+		want:    want,
+		globals: make(map[uint32]*Global),
+	}
+	g.reg.OnGlobal = g.add
+	g.reg.OnGlobalRemove = g.remove
+	if _, err := dsp.Roundtrip(); err != nil {
+		g.Destroy()
+		return nil, fmt.Errorf("couldn't collect globals: %w", err)
+	}
+	return g, nil
+}
+
+func (g *Globals) add(name uint32, iface string, version uint32) {
+	glob := &Global{Name: name, Interface: iface, Version: version}
+	if limit, ok := g.want[iface]; ok {
+		if limit != 0 {
+			version = min(version, limit)
+		}
+		// We have checked that the interface is supported.
+		glob.Proxy, _ = g.reg.BindGlobal(name, iface, version)
+	}
+	g.globals[name] = glob
+	if g.OnAdd != nil {
+		g.OnAdd(glob)
+	}
+}
+
+func (g *Globals) remove(name uint32) {
+	glob, ok := g.globals[name]
+	if !ok {
+		return
+	}
+	delete(g.globals, name)
+	if g.OnRemove != nil {
+		g.OnRemove(glob)
+	}
+	if glob.Proxy != nil {
+		glob.Proxy.Destroy()
+	}
+}
+
+// Registry returns the registry used by g.
+func (g *Globals) Registry() *Registry {
+	return g.reg
+}
+
+// All returns all currently advertised globals, ordered by name.
+func (g *Globals) All() []*Global {
+	out := make([]*Global, 0, len(g.globals))
+	for _, glob := range g.globals {
+		out = append(out, glob)
+	}
+	slices.SortFunc(out, func(a, b *Global) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+// Lookup returns the currently advertised globals with the given interface, ordered by name.
+func (g *Globals) Lookup(iface string) []*Global {
+	out := g.All()
+	return slices.DeleteFunc(out, func(glob *Global) bool { return glob.Interface != iface })
+}
+
+// BoundProxies returns the bound proxies of type T, such as all *Output, ordered by the
+// names of their globals.
+func BoundProxies[T Proxy](g *Globals) []T {
+	var out []T
+	for _, glob := range g.All() {
+		if p, ok := glob.Proxy.(T); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// BoundProxy returns the bound proxy of type T, for singleton globals such as *Compositor.
+// If there are multiple such proxies, it returns the one with the lowest name.
+func BoundProxy[T Proxy](g *Globals) (T, bool) {
+	for _, glob := range g.All() {
+		if p, ok := glob.Proxy.(T); ok {
+			return p, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Destroy destroys all bound proxies and the registry.
+func (g *Globals) Destroy() {
+	for _, glob := range g.globals {
+		if glob.Proxy != nil {
+			glob.Proxy.Destroy()
+		}
+	}
+	g.globals = nil
+	g.reg.Destroy()
+}
@@ -0,0 +1,86 @@
+package wayland
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGlobalsHotplug(t *testing.T) {
+	s, dsp := newTestServer(t, nil,
+		testGlobal{1, "wl_compositor", 6},
+		testGlobal{2, "wl_output", 4},
+		testGlobal{3, "wl_shm", 1})
+	g, err := NewGlobals(dsp, map[string]uint32{"wl_compositor": 0, "wl_output": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []uint32
+	for _, glob := range g.All() {
+		names = append(names, glob.Name)
+	}
+	if !slices.Equal(names, []uint32{1, 2, 3}) {
+		t.Fatalf("got globals %v, want [1 2 3]", names)
+	}
+	if glob := g.Lookup("wl_shm")[0]; glob.Proxy != nil {
+		t.Errorf("bound %s, which wasn't requested", glob.Interface)
+	}
+	comp, ok := BoundProxy[*Compositor](g)
+	if want, _ := InterfaceVersion("wl_compositor"); !ok || comp.Version() != min(want, 6) {
+		t.Errorf("got compositor %v, want one of version %d", comp, min(want, 6))
+	}
+	if _, ok := BoundProxy[*Shm](g); ok {
+		t.Error("BoundProxy returned an unbound proxy")
+	}
+
+	// Plug in another output.
+	var added []*Global
+	g.OnAdd = func(glob *Global) { added = append(added, glob) }
+	reg := g.Registry()
+	s.send(reg.ID(), 0, uint32(5), "wl_output", uint32(4))
+	roundtrip(t, dsp)
+	if len(added) != 1 || added[0].Name != 5 || added[0].Version != 4 {
+		t.Fatalf("OnAdd was called with %v", added)
+	}
+	outs := BoundProxies[*Output](g)
+	if len(outs) != 2 || outs[1] != added[0].Proxy {
+		t.Fatalf("got outputs %v, want the new one last", outs)
+	}
+	for _, out := range outs {
+		if out.Version() != 2 {
+			t.Errorf("bound output version %d, want the requested 2", out.Version())
+		}
+	}
+
+	// Unplug the first one. Its proxy is still live in OnRemove.
+	var removed []*Global
+	g.OnRemove = func(glob *Global) {
+		if glob.Proxy.Handle() == nil {
+			t.Error("proxy was destroyed before OnRemove")
+		}
+		removed = append(removed, glob)
+	}
+	s.send(reg.ID(), 1, uint32(2))
+	// Unknown globals are ignored.
+	s.send(reg.ID(), 1, uint32(100))
+	roundtrip(t, dsp)
+	if len(removed) != 1 || removed[0].Proxy != outs[0] {
+		t.Fatalf("OnRemove was called with %v", removed)
+	}
+	if outs[0].Handle() != nil {
+		t.Error("proxy of the removed global wasn't destroyed")
+	}
+	if got := BoundProxies[*Output](g); len(got) != 1 || got[0] != outs[1] {
+		t.Errorf("got outputs %v after removal, want %v", got, outs[1:])
+	}
+	if len(g.Lookup("wl_output")) != 1 {
+		t.Errorf("Lookup still returns the removed global")
+	}
+
+	g.Destroy()
+	roundtrip(t, dsp)
+	for iface, n := range dsp.LiveProxies() {
+		if n != 0 {
+			t.Errorf("%d %s proxies are live after Destroy", n, iface)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package wayland
+
+// #include <poll.h>
+// #include <wayland-client.h>
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Run dispatches events on the default queue until ctx is canceled or the connection fails.
+// Unlike Dispatch, it doesn't block an OS thread while waiting for events; the display's file
+// descriptor is integrated into the Go runtime's network poller.
+//
+// Run follows libwayland's protocol for reading events: it dispatches pending events until
+// it can prepare to read, flushes outgoing requests, waiting for the socket to become
+// writable if necessary, waits for the socket to become readable, and reads and dispatches
+// the events. Event handlers run on the goroutine calling Run.
+//
+// When ctx is canceled, Run stops waiting and returns ctx.Err(). Otherwise, it returns the
+// error that caused the connection to fail.
+//
+// While Run is running, the display's file descriptor is in non-blocking mode. Run restores
+// the mode when it returns.
+func (dsp *Display) Run(ctx context.Context) error {
+	return dsp.run(ctx, nil)
+}
+
+// RoundtripContext is like Roundtrip, but stops waiting and returns ctx.Err() when ctx is
+// canceled. Like Run, it doesn't block an OS thread while waiting.
+func (dsp *Display) RoundtripContext(ctx context.Context) error {
+	s := dsp.Sync(nil)
+	err := dsp.run(ctx, func() bool {
+		select {
+		case <-s.Done():
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		s.Cancel()
+	}
+	return err
+}
+
+// RoundtripTimeout is like Roundtrip, but gives up after d and returns
+// context.DeadlineExceeded.
+func (dsp *Display) RoundtripTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return dsp.RoundtripContext(ctx)
+}
+
+// run implements Run. If done isn't nil, it returns once done returns true, which it checks
+// after dispatching events.
+func (dsp *Display) run(ctx context.Context, done func() bool) error {
+	if dsp.prepared {
+		panic("called Run while prepared to read")
+	}
+
+	// We use our own copy of the file descriptor so that closing the os.File doesn't close
+	// the connection. The copy shares the file status flags with the display's descriptor,
+	// however, so making it non-blocking for the network poller affects the display, too.
+	// We restore the flag when we're done, in case the application polls the display
+	// itself.
+	fd, err := syscall.Dup(int(dsp.Fd()))
+	if err != nil {
+		return fmt.Errorf("couldn't duplicate display file descriptor: %w", err)
+	}
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		syscall.Close(fd)
+		return fmt.Errorf("couldn't get display file descriptor flags: %w", errno)
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("couldn't make display file descriptor non-blocking: %w", err)
+	}
+	if flags&syscall.O_NONBLOCK == 0 {
+		// This runs after our copy has been closed.
+		defer syscall.SetNonblock(int(dsp.Fd()), false)
+	}
+	f := os.NewFile(uintptr(fd), "wayland")
+	defer f.Close()
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	// Setting a deadline in the past wakes up any waits on the file.
+	stop := context.AfterFunc(ctx, func() { f.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	// wait waits until the display's file descriptor is ready for the given poll events.
+	wait := func(events C.short) error {
+		ready := func(fd uintptr) bool {
+			pfd := C.struct_pollfd{fd: C.int(fd), events: events}
+			return C.poll(&pfd, 1, 0) > 0
+		}
+		var err error
+		if events == C.POLLOUT {
+			err = rc.Write(ready)
+		} else {
+			err = rc.Read(ready)
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for dsp.PrepareRead() != 0 {
+			if dsp.DispatchPending() == -1 {
+				return dsp.lastError()
+			}
+		}
+		if done != nil && done() {
+			dsp.CancelRead()
+			return nil
+		}
+		if err := dsp.flush(wait); err != nil {
+			dsp.CancelRead()
+			return err
+		}
+		if err := wait(C.POLLIN); err != nil {
+			dsp.CancelRead()
+			return err
+		}
+		if err := dsp.ReadEvents(); err != nil {
+			return err
+		}
+		if dsp.DispatchPending() == -1 {
+			return dsp.lastError()
+		}
+	}
+}
+
+// dispatchPending dispatches the events queued on q without reading from the connection.
+// Unlike libwayland's dispatch functions, ours hold q's dispatch lock; see queue.dispatchMu.
+func (q *queue) dispatchPending() int {
+	q.dispatchMu.Lock()
+	defer q.dispatchMu.Unlock()
+	prev := q.dispatching
+	q.dispatching = true
+	defer func() { q.dispatching = prev }()
+	if q.hnd == nil {
+		return int(C.wl_display_dispatch_pending(q.dsp.hnd))
+	}
+	return int(C.wl_display_dispatch_queue_pending(q.dsp.hnd, q.hnd))
+}
+
+// dispatch dispatches events on q, blocking until there are some. It does the same as
+// wl_display_dispatch_queue, but doesn't hold q's dispatch lock while waiting for events.
+func (q *queue) dispatch() (int, error) {
+	dsp := q.dsp
+	var prepared C.int
+	if q.hnd == nil {
+		prepared = C.wl_display_prepare_read(dsp.hnd)
+	} else {
+		prepared = C.wl_display_prepare_read_queue(dsp.hnd, q.hnd)
+	}
+	if prepared != 0 {
+		// Events are already queued. This is also the case after a protocol error, which
+		// leaves them queued forever.
+		n := q.dispatchPending()
+		if n == -1 {
+			return -1, dsp.lastError()
+		}
+		return n, nil
+	}
+
+	wait := func(events C.short) error {
+		pfd := C.struct_pollfd{fd: C.wl_display_get_fd(dsp.hnd), events: events}
+		for {
+			n, err := C.poll(&pfd, 1, -1)
+			if n >= 0 {
+				return nil
+			}
+			if err != syscall.EINTR {
+				return fmt.Errorf("couldn't poll display: %w", err)
+			}
+		}
+	}
+	// Like libwayland, we still read events when the server has closed the connection, as
+	// it may have sent an error.
+	if err := dsp.flush(wait); err != nil && !errors.Is(err, syscall.EPIPE) {
+		C.wl_display_cancel_read(dsp.hnd)
+		return -1, err
+	}
+	if err := wait(C.POLLIN); err != nil {
+		C.wl_display_cancel_read(dsp.hnd)
+		return -1, err
+	}
+	if C.wl_display_read_events(dsp.hnd) == -1 {
+		return -1, dsp.lastError()
+	}
+	n := q.dispatchPending()
+	if n == -1 {
+		return -1, dsp.lastError()
+	}
+	return n, nil
+}
+
+// roundtrip dispatches events on q until s, a sync request on q, has completed. Like
+// wl_display_roundtrip_queue, it returns the result of the last dispatch.
+func (q *queue) roundtrip(s *SyncRequest) (int, error) {
+	var n int
+	for {
+		select {
+		case <-s.Done():
+			return n, nil
+		default:
+		}
+		if q.panicked != nil {
+			// Handlers don't run after a panic, but the dispatcher still destroys the
+			// callback when the reply arrives.
+			if _, ok := q.get((*C.struct_wl_proxy)(s.cb.Handle())); !ok {
+				return n, nil
+			}
+		}
+		var err error
+		n, err = q.dispatch()
+		if err != nil {
+			s.Cancel()
+			return n, err
+		}
+	}
+}
+
+// flush flushes all outgoing requests, using wait to wait for the socket to become writable
+// when the socket buffer is full.
+func (dsp *Display) flush(wait func(events C.short) error) error {
+	for {
+		n, err := C.wl_display_flush(dsp.hnd)
+		if n != -1 {
+			return nil
+		}
+		if err != syscall.EAGAIN {
+			return fmt.Errorf("couldn't flush requests: %w", err)
+		}
+		if err := wait(C.POLLOUT); err != nil {
+			return err
+		}
+	}
+}
+
+// lastError returns the error that caused the connection to fail.
+func (dsp *Display) lastError() error {
+	errno := syscall.Errno(C.wl_display_get_error(dsp.hnd))
+	if errno == syscall.EPROTO {
+		var iface *C.struct_wl_interface
+		var id C.uint32_t
+		code := C.wl_display_get_protocol_error(dsp.hnd, &iface, &id)
+		if iface != nil {
+			return fmt.Errorf("protocol error %d on %s@%d", code, C.GoString(iface.name), id)
+		}
+		return fmt.Errorf("protocol error %d", code)
+	}
+	return fmt.Errorf("connection failed: %w", errno)
+}
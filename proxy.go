@@ -0,0 +1,143 @@
+package wayland
+
+// #include <wayland-client.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Proxy is implemented by all protocol objects, except for Display. It allows writing code
+// that works with any kind of object, such as loggers and leak trackers.
+type Proxy interface {
+	// ID returns the object's ID in the connection. IDs are reused after objects have been
+	// destroyed; the ID of a destroyed object is the one it had before.
+	ID() uint32
+	// Interface returns the name of the object's interface, such as "wl_surface".
+	Interface() string
+	// Version returns the version of the interface the object has been created with.
+	Version() int
+	// Handle returns the underlying struct wl_proxy pointer, or nil if the object has been
+	// destroyed.
+	Handle() unsafe.Pointer
+	// Destroy destroys the object. Destroying an object more than once has no effect, unless
+	// Display.StrictDestroy is set.
+	Destroy()
+
+	display() *Display
+}
+
+var (
+	_ Proxy = (*Buffer)(nil)
+	_ Proxy = (*Callback)(nil)
+	_ Proxy = (*Compositor)(nil)
+	_ Proxy = (*LinuxBufferParams)(nil)
+	_ Proxy = (*LinuxDmabuf)(nil)
+	_ Proxy = (*LinuxDmabufFeedback)(nil)
+	_ Proxy = (*Output)(nil)
+	_ Proxy = (*Registry)(nil)
+	_ Proxy = (*Shm)(nil)
+	_ Proxy = (*ShmPool)(nil)
+	_ Proxy = (*Surface)(nil)
+	_ Proxy = (*WpFractionalScale)(nil)
+	_ Proxy = (*WpFractionalScaleManager)(nil)
+	_ Proxy = (*WpPresentation)(nil)
+	_ Proxy = (*WpPresentationFeedback)(nil)
+	_ Proxy = (*WpViewport)(nil)
+	_ Proxy = (*WpViewporter)(nil)
+	_ Proxy = (*XdgDecorationManager)(nil)
+	_ Proxy = (*XdgSurface)(nil)
+	_ Proxy = (*XdgToplevel)(nil)
+	_ Proxy = (*XdgToplevelDecoration)(nil)
+	_ Proxy = (*XdgWmBase)(nil)
+)
+
+// ErrDestroyed is the error wrapped by errors and panics caused by using destroyed proxies.
+var ErrDestroyed = errors.New("proxy has been destroyed")
+
+// proxyID returns the ID of a proxy, or id, the ID recorded when it was destroyed, if hnd is
+// nil.
+func proxyID(hnd unsafe.Pointer, id uint32) uint32 {
+	if hnd == nil {
+		return id
+	}
+	return uint32(C.wl_proxy_get_id((*C.struct_wl_proxy)(hnd)))
+}
+
+// ErrUnsupportedVersion is the error wrapped by errors returned by requests that the bound
+// version of an object doesn't support. Sending such a request would cause a protocol error.
+var ErrUnsupportedVersion = errors.New("unsupported by bound version")
+
+// checkVersion checks that p's version supports the request, which has been added in version
+// since.
+func checkVersion(p Proxy, request string, since int) error {
+	if p.Version() < since {
+		return fmt.Errorf("%s.%s requires version %d, have %d: %w", p.Interface(), request, since, p.Version(), ErrUnsupportedVersion)
+	}
+	return nil
+}
+
+func destroyedError(p Proxy) error {
+	return fmt.Errorf("use of destroyed %s@%d: %w", p.Interface(), p.ID(), ErrDestroyed)
+}
+
+// checkLive panics if p has been destroyed. Passing a destroyed proxy to libwayland would
+// make it use freed memory.
+func checkLive(p Proxy) {
+	if p.Handle() == nil {
+		panic(destroyedError(p))
+	}
+}
+
+// destroyedTwice is called by Destroy when p has already been destroyed.
+func (dsp *Display) destroyedTwice(p Proxy) {
+	if dsp.StrictDestroy {
+		panic(fmt.Errorf("double destroy of %s@%d: %w", p.Interface(), p.ID(), ErrDestroyed))
+	}
+}
+
+// SetUserData attaches v to p. Each proxy can have one value per type T, which allows
+// independent packages to attach their own data without coordination, similar to the values
+// of a context.Context. The data is released when the proxy gets destroyed.
+func SetUserData[T any](p Proxy, v T) {
+	dsp := p.display()
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	if dsp.userData == nil {
+		dsp.userData = make(map[Proxy]map[reflect.Type]any)
+	}
+	m := dsp.userData[p]
+	if m == nil {
+		m = make(map[reflect.Type]any)
+		dsp.userData[p] = m
+	}
+	m[reflect.TypeFor[T]()] = v
+}
+
+// UserData returns the value of type T attached to p by SetUserData, if any.
+func UserData[T any](p Proxy) (T, bool) {
+	dsp := p.display()
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	v, ok := dsp.userData[p][reflect.TypeFor[T]()]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// DeleteUserData removes the value of type T attached to p, if any.
+func DeleteUserData[T any](p Proxy) {
+	dsp := p.display()
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	m := dsp.userData[p]
+	delete(m, reflect.TypeFor[T]())
+	if len(m) == 0 {
+		delete(dsp.userData, p)
+	}
+}
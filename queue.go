@@ -0,0 +1,170 @@
+package wayland
+
+// #include <wayland-client.h>
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// EventQueue is an event queue other than the default one. Events of proxies assigned to the
+// queue are only dispatched by DispatchQueue, DispatchQueuePending and RoundtripQueue.
+//
+// New proxies are assigned to the queue of the proxy that created them. To create proxies on
+// a queue, send the creating request via a proxy wrapper (see WrapProxy), or use
+// EventQueue.Sync. This allows, for example, a render goroutine to wait for a surface's frame
+// callbacks independently of the main event loop.
+//
+// Each queue is dispatched independently, so proxies on different queues can be handled by
+// different goroutines. A queue must not be dispatched by more than one goroutine at a time.
+type EventQueue struct {
+	queue
+	pinner runtime.Pinner
+}
+
+func (dsp *Display) NewQueue() *EventQueue {
+	q := &EventQueue{}
+	q.queue.init(dsp)
+	q.hnd = C.wl_display_create_queue(dsp.hnd)
+	q.pinner.Pin(q)
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	if dsp.queues == nil {
+		dsp.queues = make(map[*C.struct_wl_event_queue]*EventQueue)
+	}
+	dsp.queues[q.hnd] = q
+	return q
+}
+
+func (q *EventQueue) Handle() unsafe.Pointer {
+	return unsafe.Pointer(q.hnd)
+}
+
+// Destroy destroys the queue. All proxies assigned to the queue should be destroyed first.
+func (q *EventQueue) Destroy() {
+	if q.hnd == nil {
+		panic("double destroy of wayland.EventQueue")
+	}
+	q.dsp.mu.Lock()
+	delete(q.dsp.queues, q.hnd)
+	q.dsp.mu.Unlock()
+	C.wl_event_queue_destroy(q.hnd)
+	q.hnd = nil
+	q.pinner.Unpin()
+}
+
+// Sync is like Display.Sync, but the callback is assigned to q.
+func (q *EventQueue) Sync(fn func(data uint32)) *SyncRequest {
+	defer q.creating()()
+	wrapper := C.wl_proxy_create_wrapper(unsafe.Pointer(q.dsp.hnd))
+	C.wl_proxy_set_queue((*C.struct_wl_proxy)(wrapper), q.hnd)
+	cb := q.dsp.newCallback(C.wl_display_sync((*C.struct_wl_display)(wrapper)), nil)
+	C.wl_proxy_wrapper_destroy(wrapper)
+	s := newSyncRequest(cb, fn)
+	q.dsp.traceDisplayRequest("sync", cb)
+	return s
+}
+
+// Registry is like Display.Registry, but the registry is assigned to q, and so are the
+// globals bound with it.
+func (q *EventQueue) Registry() *Registry {
+	defer q.creating()()
+	wrapper := C.wl_proxy_create_wrapper(unsafe.Pointer(q.dsp.hnd))
+	C.wl_proxy_set_queue((*C.struct_wl_proxy)(wrapper), q.hnd)
+	reg := &Registry{
+		dsp: q.dsp,
+		hnd: C.wl_display_get_registry((*C.struct_wl_display)(wrapper)),
+	}
+	C.wl_proxy_wrapper_destroy(wrapper)
+	q.dsp.add((*C.struct_wl_proxy)(reg.hnd), reg)
+	q.dsp.traceDisplayRequest("get_registry", reg)
+	return reg
+}
+
+// DispatchQueue is like Dispatch, but for q.
+func (dsp *Display) DispatchQueue(q *EventQueue) (int, error) {
+	n, err := q.dispatch()
+	q.checkPanic()
+	return n, err
+}
+
+// DispatchQueuePending is like DispatchPending, but for q.
+func (dsp *Display) DispatchQueuePending(q *EventQueue) int {
+	n := q.dispatchPending()
+	q.checkPanic()
+	return n
+}
+
+// RoundtripQueue is like Roundtrip, but dispatches events on q.
+func (dsp *Display) RoundtripQueue(q *EventQueue) (int, error) {
+	n, err := q.roundtrip(q.Sync(nil))
+	q.checkPanic()
+	return n, err
+}
+
+// ProxyWrapper is a wrapper for a proxy, created by WrapProxy. Requests sent via the wrapper
+// behave like requests sent via the proxy, except that new objects are assigned to the
+// wrapper's queue instead of the proxy's.
+type ProxyWrapper[T any] struct {
+	proxy *T
+	hnd   unsafe.Pointer
+}
+
+// WrapProxy creates a wrapper for proxy, which must be one of the package's proxy types,
+// such as *Surface, that assigns new objects to q.
+//
+// A wrapper avoids the race between creating an object and assigning it to a queue: without
+// it, events for the new object could be dispatched on the proxy's queue before the object
+// gets moved to q.
+func WrapProxy[T any](q *EventQueue, proxy *T) *ProxyWrapper[T] {
+	if _, ok := any(proxy).(*Display); ok {
+		panic("can't wrap Display, use EventQueue.Sync instead")
+	}
+	field, ok := reflect.TypeFor[T]().FieldByName("hnd")
+	if !ok || len(field.Index) != 1 || field.Type.Kind() != reflect.Pointer {
+		panic(fmt.Sprintf("%T isn't a proxy", proxy))
+	}
+	if p, ok := any(proxy).(Proxy); ok {
+		checkLive(p)
+	}
+	hndPtr := func(p *T) *unsafe.Pointer {
+		return (*unsafe.Pointer)(unsafe.Add(unsafe.Pointer(p), field.Offset))
+	}
+
+	wrapper := C.wl_proxy_create_wrapper(*hndPtr(proxy))
+	C.wl_proxy_set_queue((*C.struct_wl_proxy)(wrapper), q.hnd)
+	// Only copy the fields that identify the proxy. Event handlers, locks and other state
+	// belong to the original proxy and mustn't be copied or shared.
+	cpy := new(T)
+	for _, name := range [...]string{"dsp", "id", "vers"} {
+		f, ok := reflect.TypeFor[T]().FieldByName(name)
+		if !ok || len(f.Index) != 1 {
+			continue
+		}
+		reflect.NewAt(f.Type, unsafe.Add(unsafe.Pointer(cpy), f.Offset)).Elem().
+			Set(reflect.NewAt(f.Type, unsafe.Add(unsafe.Pointer(proxy), f.Offset)).Elem())
+	}
+	*hndPtr(cpy) = wrapper
+	return &ProxyWrapper[T]{proxy: cpy, hnd: wrapper}
+}
+
+// Proxy returns a value of the wrapped proxy's type that sends requests via the wrapper. It
+// must not be used for anything but sending requests that create objects, and in particular
+// it must not be destroyed; use ProxyWrapper.Destroy instead.
+func (w *ProxyWrapper[T]) Proxy() *T {
+	return w.proxy
+}
+
+// Destroy destroys the wrapper. It doesn't affect the wrapped proxy or objects created via
+// the wrapper.
+func (w *ProxyWrapper[T]) Destroy() {
+	if w.hnd == nil {
+		panic("double destroy of wayland.ProxyWrapper")
+	}
+	C.wl_proxy_wrapper_destroy(w.hnd)
+	w.hnd = nil
+	w.proxy = nil
+}
@@ -0,0 +1,61 @@
+package wayland
+
+import "testing"
+
+// wl_surface.frame opcode
+const surfaceFrame = 3
+
+// newTestCompositor binds a compositor. The server answers frame requests of surfaces
+// immediately.
+func newTestCompositor(t *testing.T) (*Display, *Compositor) {
+	t.Helper()
+	_, dsp := newTestServer(t, func(s *testServer, req testRequest) {
+		if req.opcode == surfaceFrame {
+			// Surfaces are the only objects with a request of that opcode that are created
+			// by these tests.
+			cb := req.uint(0)
+			s.deleteID(cb)
+			s.send(cb, 0, uint32(16))
+		}
+	}, testGlobal{1, "wl_compositor", 6})
+	return dsp, bindGlobal[*Compositor](t, dsp, 1, 6)
+}
+
+// newTestSurface creates a surface with a compositor from newTestCompositor.
+func newTestSurface(t *testing.T) (*Display, *Surface) {
+	t.Helper()
+	dsp, comp := newTestCompositor(t)
+	return dsp, comp.CreateSurface()
+}
+
+func TestWrapProxy(t *testing.T) {
+	dsp, surf := newTestSurface(t)
+	surf.OnEnter = func(*Output) {}
+	surf.RequestFrame(nil)
+
+	q := dsp.NewQueue()
+	defer q.Destroy()
+	w := WrapProxy(q, surf)
+	defer w.Destroy()
+	cpy := w.Proxy()
+	if cpy.OnEnter != nil || cpy.frame != nil {
+		t.Error("wrapper copied the surface's handlers or frame state")
+	}
+	if cpy.dsp != surf.dsp || cpy.vers != surf.vers || cpy.ID() != surf.ID() {
+		t.Errorf("wrapper identifies as %d version %d, want %d version %d", cpy.ID(), cpy.vers, surf.ID(), surf.vers)
+	}
+
+	// Callbacks created via the wrapper belong to q.
+	var done bool
+	cpy.Frame(func(uint32) { done = true })
+	roundtrip(t, dsp)
+	if done {
+		t.Fatal("callback created via wrapper was dispatched on the default queue")
+	}
+	if _, err := dsp.RoundtripQueue(q); err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Fatal("callback created via wrapper wasn't dispatched on its queue")
+	}
+}
@@ -0,0 +1,115 @@
+package wayland
+
+// #include <wayland-client.h>
+import "C"
+
+// SurfaceScale is the scale a surface should be rendered at.
+type SurfaceScale struct {
+	// Buffer is the scale to pass to Surface.SetBufferScale.
+	Buffer int
+	// Fractional is the scale to render at. If it isn't an integer, Buffer is 1 and the
+	// surface has to use a viewport to map the buffer to the surface size; see ScaleSize.
+	Fractional float64
+}
+
+// IsFractional reports whether the scale requires a viewport.
+func (sc SurfaceScale) IsFractional() bool {
+	return sc.Fractional != float64(sc.Buffer)
+}
+
+// ScaleTracker tracks the scale of a surface. The compositor communicates scale in several
+// ways, depending on the protocol versions in use. In order of preference, ScaleTracker uses
+//
+//   - the preferred scale of wp_fractional_scale_v1, if a manager has been provided,
+//   - the preferred buffer scale of wl_surface version 6 and newer,
+//   - the largest scale of the outputs the surface is on.
+//
+// Sources are only used once the compositor has sent information for them. A surface can
+// have at most one ScaleTracker. Destroying the surface destroys its ScaleTracker.
+type ScaleTracker struct {
+	surf  *Surface
+	frac  *WpFractionalScale
+	scale SurfaceScale
+
+	// OnChange is called whenever the surface's scale changes. It is called while
+	// dispatching the event that caused the change, which may be an event of one of the
+	// surface's outputs, and thus on another queue than the surface's.
+	OnChange func(scale SurfaceScale)
+}
+
+// NewScaleTracker returns a tracker for surf. mgr may be nil if the compositor doesn't
+// support fractional scaling. The tracker creates the surface's wp_fractional_scale_v1 object.
+func NewScaleTracker(surf *Surface, mgr *WpFractionalScaleManager) *ScaleTracker {
+	t := &ScaleTracker{
+		surf:  surf,
+		scale: SurfaceScale{Buffer: 1, Fractional: 1},
+	}
+	if mgr != nil {
+		t.frac = mgr.FractionalScale(surf)
+		t.frac.OnPreferred_scale = func(float64) { t.update() }
+	}
+	surf.dsp.mu.Lock()
+	defer surf.dsp.mu.Unlock()
+	if surf.tracker != nil {
+		panic("surface already has a ScaleTracker")
+	}
+	surf.tracker = t
+	t.scale = t.compute()
+	return t
+}
+
+// Scale returns the current scale of the surface.
+func (t *ScaleTracker) Scale() SurfaceScale {
+	t.surf.dsp.mu.Lock()
+	defer t.surf.dsp.mu.Unlock()
+	return t.scale
+}
+
+// compute computes the surface's scale. t.surf.dsp.mu must be held.
+func (t *ScaleTracker) compute() SurfaceScale {
+	if t.frac != nil && t.frac.scale != 0 {
+		f := float64(t.frac.scale) / FractionalScaleDenominator
+		if t.frac.scale%FractionalScaleDenominator == 0 {
+			return SurfaceScale{Buffer: int(f), Fractional: f}
+		}
+		return SurfaceScale{Buffer: 1, Fractional: f}
+	}
+	if t.surf.vers >= C.WL_SURFACE_PREFERRED_BUFFER_SCALE_SINCE_VERSION && t.surf.preferredScale > 0 {
+		return SurfaceScale{Buffer: t.surf.preferredScale, Fractional: float64(t.surf.preferredScale)}
+	}
+	if len(t.surf.outputs) == 0 {
+		// Keep the current scale while the surface isn't on any output, for example while
+		// it is being moved between outputs.
+		return t.scale
+	}
+	scale := 1
+	for _, out := range t.surf.outputs {
+		scale = max(scale, int(out.scale))
+	}
+	return SurfaceScale{Buffer: scale, Fractional: float64(scale)}
+}
+
+func (t *ScaleTracker) update() {
+	t.surf.dsp.mu.Lock()
+	scale := t.compute()
+	changed := scale != t.scale
+	t.scale = scale
+	t.surf.dsp.mu.Unlock()
+	if changed && t.OnChange != nil {
+		t.OnChange(scale)
+	}
+}
+
+// Destroy stops tracking the surface and destroys the wp_fractional_scale_v1 object, if any.
+func (t *ScaleTracker) Destroy() {
+	t.surf.dsp.mu.Lock()
+	frac := t.frac
+	t.frac = nil
+	if t.surf.tracker == t {
+		t.surf.tracker = nil
+	}
+	t.surf.dsp.mu.Unlock()
+	if frac != nil {
+		frac.Destroy()
+	}
+}
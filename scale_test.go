@@ -0,0 +1,98 @@
+package wayland
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestScaleTrackerPreference(t *testing.T) {
+	s, dsp := newTestServer(t, nil,
+		testGlobal{1, "wl_compositor", 6},
+		testGlobal{2, "wl_output", 2},
+		testGlobal{3, "wl_output", 2},
+		testGlobal{4, "wp_fractional_scale_manager_v1", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	out1 := bindGlobal[*Output](t, dsp, 2, 2)
+	out2 := bindGlobal[*Output](t, dsp, 3, 2)
+	mgr := bindGlobal[*WpFractionalScaleManager](t, dsp, 4, 1)
+	for out, scale := range map[*Output]int32{out1: 2, out2: 3} {
+		s.send(out.ID(), 3, scale)
+		s.send(out.ID(), 2)
+	}
+	surf := comp.CreateSurface()
+	tr := NewScaleTracker(surf, mgr)
+	var got []SurfaceScale
+	tr.OnChange = func(sc SurfaceScale) { got = append(got, sc) }
+	if sc := tr.Scale(); sc != (SurfaceScale{1, 1}) {
+		t.Errorf("initial scale is %v, want 1", sc)
+	}
+
+	steps := []struct {
+		name string
+		// since is the wl_surface version the step requires.
+		since int
+		do    func()
+		want  SurfaceScale
+	}{
+		{"enter first output", 1, func() { s.send(surf.ID(), 0, out1.ID()) }, SurfaceScale{2, 2}},
+		{"enter second output", 1, func() { s.send(surf.ID(), 0, out2.ID()) }, SurfaceScale{3, 3}},
+		{"leave second output", 1, func() { s.send(surf.ID(), 1, out2.ID()) }, SurfaceScale{2, 2}},
+		{"preferred buffer scale", 6, func() { s.send(surf.ID(), 2, int32(1)) }, SurfaceScale{1, 1}},
+		{"enter output after preferred buffer scale", 6, func() { s.send(surf.ID(), 0, out2.ID()) }, SurfaceScale{1, 1}},
+		{"fractional scale", 1, func() { s.send(tr.frac.ID(), 0, uint32(180)) }, SurfaceScale{1, 1.5}},
+		{"integer fractional scale", 1, func() { s.send(tr.frac.ID(), 0, uint32(240)) }, SurfaceScale{2, 2}},
+		{"preferred buffer scale after fractional scale", 6, func() { s.send(surf.ID(), 2, int32(3)) }, SurfaceScale{2, 2}},
+	}
+	var want []SurfaceScale
+	for _, step := range steps {
+		if surf.Version() < step.since {
+			// libwayland supports wl_surface version 6 since 1.22.
+			t.Logf("skipping %q, which requires wl_surface version %d", step.name, step.since)
+			continue
+		}
+		step.do()
+		roundtrip(t, dsp)
+		if sc := tr.Scale(); sc != step.want {
+			t.Errorf("%s: got scale %v, want %v", step.name, sc, step.want)
+		}
+		if len(want) == 0 || want[len(want)-1] != step.want {
+			want = append(want, step.want)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("OnChange was called with %v, want %v", got, want)
+	}
+}
+
+func TestSurfaceDestroyScaleTracker(t *testing.T) {
+	var mu sync.Mutex
+	var destroyed []uint32
+	_, dsp := newTestServer(t, func(s *testServer, req testRequest) {
+		// Destroy is opcode 0 of both wl_surface and wp_fractional_scale_v1.
+		if req.opcode == 0 {
+			mu.Lock()
+			destroyed = append(destroyed, req.id)
+			mu.Unlock()
+		}
+	}, testGlobal{1, "wl_compositor", 6}, testGlobal{2, "wp_fractional_scale_manager_v1", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	mgr := bindGlobal[*WpFractionalScaleManager](t, dsp, 2, 1)
+	surf := comp.CreateSurface()
+	tr := NewScaleTracker(surf, mgr)
+	frac, surfID := tr.frac.ID(), surf.ID()
+	surf.Destroy()
+	roundtrip(t, dsp)
+
+	mu.Lock()
+	defer mu.Unlock()
+	destroyed = slices.DeleteFunc(destroyed, func(id uint32) bool { return id != frac && id != surfID })
+	if !slices.Equal(destroyed, []uint32{frac, surfID}) {
+		t.Errorf("destroyed objects %v, want the fractional scale %d before the surface %d", destroyed, frac, surfID)
+	}
+	if surf.tracker != nil || tr.frac != nil {
+		t.Error("surface still has its tracker")
+	}
+	// Destroying the tracker afterwards is harmless.
+	tr.Destroy()
+}
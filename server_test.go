@@ -0,0 +1,290 @@
+package wayland
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testServer is a minimal Wayland compositor speaking the wire protocol over a socket pair.
+// It implements wl_display.sync, wl_display.get_registry and the advertisement of globals;
+// all other requests are passed to the request hook, which can respond with send.
+type testServer struct {
+	t       *testing.T
+	conn    *net.UnixConn
+	globals []testGlobal
+	// onRequest is called on the server's goroutine for every request not handled by the
+	// server itself. Received file descriptors are closed after it returns.
+	onRequest func(s *testServer, req testRequest)
+
+	mu   sync.Mutex // serializes writes
+	done chan struct{}
+	// failed is set after sending a protocol error. Like a real compositor, the server
+	// ignores all further requests.
+	failed atomic.Bool
+}
+
+type testGlobal struct {
+	name    uint32
+	iface   string
+	version uint32
+}
+
+type testRequest struct {
+	id     uint32
+	opcode uint16
+	body   []byte
+	fds    []int
+}
+
+// uint returns the i-th 32-bit argument of the request, for signatures that consist only of
+// fixed-size arguments up to that point.
+func (req testRequest) uint(i int) uint32 {
+	return binary.NativeEndian.Uint32(req.body[i*4:])
+}
+
+// testFd marks an argument to testServer.send as a file descriptor. The server closes its
+// copy after sending it.
+type testFd int
+
+// newTestServer starts a test server and returns a display connected to it. Both are shut
+// down at the end of the test.
+func newTestServer(t *testing.T, onRequest func(s *testServer, req testRequest), globals ...testGlobal) (*testServer, *Display) {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "wayland-server")
+	c, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		t:         t,
+		conn:      c.(*net.UnixConn),
+		globals:   globals,
+		onRequest: onRequest,
+		done:      make(chan struct{}),
+	}
+	go s.serve()
+
+	dsp, err := ConnectToFd(uintptr(fds[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dsp.Disconnect()
+		<-s.done
+		s.conn.Close()
+	})
+	return s, dsp
+}
+
+func (s *testServer) serve() {
+	defer close(s.done)
+	var buf []byte
+	var fds []int
+	b := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(28*4))
+	for {
+		n, oobn, _, _, err := s.conn.ReadMsgUnix(b, oob)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.t.Errorf("test server: %s", err)
+			}
+			for _, fd := range fds {
+				syscall.Close(fd)
+			}
+			return
+		}
+		if n == 0 {
+			return
+		}
+		buf = append(buf, b[:n]...)
+		if oobn > 0 {
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				s.t.Errorf("test server: %s", err)
+				return
+			}
+			for _, msg := range msgs {
+				rights, err := syscall.ParseUnixRights(&msg)
+				if err == nil {
+					fds = append(fds, rights...)
+				}
+			}
+		}
+		for len(buf) >= 8 {
+			size := int(binary.NativeEndian.Uint32(buf[4:]) >> 16)
+			if len(buf) < size {
+				break
+			}
+			req := testRequest{
+				id:     binary.NativeEndian.Uint32(buf),
+				opcode: uint16(binary.NativeEndian.Uint32(buf[4:])),
+				body:   buf[8:size:size],
+			}
+			// libwayland sends file descriptors together with the message that uses
+			// them, so all received file descriptors belong to this request.
+			req.fds, fds = fds, nil
+			s.handle(req)
+			for _, fd := range req.fds {
+				syscall.Close(fd)
+			}
+			buf = buf[size:]
+		}
+		buf = append([]byte(nil), buf...)
+	}
+}
+
+func (s *testServer) handle(req testRequest) {
+	if s.failed.Load() {
+		return
+	}
+	switch {
+	case req.id == 1 && req.opcode == 0:
+		// wl_display.sync
+		// delete_id goes first so that the client can't disconnect between the two events
+		// after its roundtrip has finished.
+		cb := req.uint(0)
+		s.deleteID(cb)
+		s.send(cb, 0, uint32(0))
+	case req.id == 1 && req.opcode == 1:
+		// wl_display.get_registry
+		reg := req.uint(0)
+		for _, g := range s.globals {
+			s.send(reg, 0, g.name, g.iface, g.version)
+		}
+	default:
+		if s.onRequest != nil {
+			s.onRequest(s, req)
+		}
+	}
+}
+
+// protocolError sends wl_display.error for the object id.
+func (s *testServer) protocolError(id, code uint32, msg string) {
+	s.failed.Store(true)
+	s.send(1, 0, id, code, msg)
+}
+
+// deleteID sends wl_display.delete_id, allowing the client to reuse id.
+func (s *testServer) deleteID(id uint32) {
+	s.send(1, 1, id)
+}
+
+// send sends an event. Arguments of type int32, uint32, string and []byte are encoded as
+// ints, uints, strings and arrays; file descriptors are passed as testFd.
+func (s *testServer) send(id uint32, opcode uint16, args ...any) {
+	msg := binary.NativeEndian.AppendUint32(nil, id)
+	msg = binary.NativeEndian.AppendUint32(msg, 0)
+	var fds []int
+	pad := func() {
+		for len(msg)%4 != 0 {
+			msg = append(msg, 0)
+		}
+	}
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case int32:
+			msg = binary.NativeEndian.AppendUint32(msg, uint32(arg))
+		case uint32:
+			msg = binary.NativeEndian.AppendUint32(msg, arg)
+		case string:
+			msg = binary.NativeEndian.AppendUint32(msg, uint32(len(arg)+1))
+			msg = append(msg, arg...)
+			msg = append(msg, 0)
+			pad()
+		case []byte:
+			msg = binary.NativeEndian.AppendUint32(msg, uint32(len(arg)))
+			msg = append(msg, arg...)
+			pad()
+		case testFd:
+			fds = append(fds, int(arg))
+		default:
+			s.t.Fatalf("unsupported argument type %T", arg)
+		}
+	}
+	binary.NativeEndian.PutUint32(msg[4:], uint32(len(msg))<<16|uint32(opcode))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	if _, _, err := s.conn.WriteMsgUnix(msg, oob, nil); err != nil {
+		s.t.Errorf("test server: %s", err)
+	}
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+// bindGlobal creates a registry and binds the global called name with Bind.
+func bindGlobal[T Proxy](t *testing.T, dsp *Display, name, version uint32) T {
+	t.Helper()
+	reg := dsp.Registry()
+	if _, err := dsp.Roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Bind[T](reg, name, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// roundtrip does a roundtrip and fails the test if it returns an error.
+func roundtrip(t *testing.T, dsp *Display) {
+	t.Helper()
+	if _, err := dsp.Roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestServer(t *testing.T) {
+	_, dsp := newTestServer(t, nil, testGlobal{1, "wl_compositor", 6}, testGlobal{2, "wl_shm", 1})
+	reg := dsp.Registry()
+	var got []testGlobal
+	reg.OnGlobal = func(name uint32, iface string, version uint32) {
+		got = append(got, testGlobal{name, iface, version})
+	}
+	roundtrip(t, dsp)
+	if len(got) != 2 || got[0] != (testGlobal{1, "wl_compositor", 6}) || got[1] != (testGlobal{2, "wl_shm", 1}) {
+		t.Errorf("got globals %v", got)
+	}
+}
+
+func TestRoundtripAfterProtocolError(t *testing.T) {
+	s, dsp := newTestServer(t, nil)
+	// libwayland handles the error before dispatching the default queue, so the global event
+	// stays queued forever.
+	reg := dsp.Registry()
+	s.send(reg.ID(), 0, uint32(1), "wl_compositor", uint32(1))
+	s.protocolError(1, 3, "broken")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Both roundtrips fail; the second one used to spin forever.
+		for i := range 2 {
+			if _, err := dsp.Roundtrip(); err == nil {
+				t.Errorf("roundtrip %d didn't fail", i)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("roundtrip after a protocol error didn't return")
+	}
+}
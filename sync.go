@@ -0,0 +1,64 @@
+package wayland
+
+import "sync"
+
+// SyncRequest is a pending sync request, created by Display.Sync or EventQueue.Sync. Its
+// completion can be waited for in a select statement, as long as some goroutine dispatches
+// the queue it has been created on.
+type SyncRequest struct {
+	cb   *Callback
+	done chan struct{}
+	data uint32
+
+	// mu orders Cancel with the dispatcher delivering the reply; whichever comes first sets
+	// its flag.
+	mu       sync.Mutex
+	canceled bool
+	replied  bool
+}
+
+func newSyncRequest(cb *Callback, fn func(data uint32)) *SyncRequest {
+	s := &SyncRequest{cb: cb, done: make(chan struct{})}
+	cb.OnDone = func(data uint32) {
+		s.mu.Lock()
+		if s.canceled {
+			// The reply was dispatched while Cancel destroyed the callback.
+			s.mu.Unlock()
+			return
+		}
+		s.replied = true
+		s.mu.Unlock()
+		s.data = data
+		if fn != nil {
+			fn(data)
+		}
+		close(s.done)
+	}
+	return s
+}
+
+// Done returns a channel that is closed once the server has replied.
+func (s *SyncRequest) Done() <-chan struct{} {
+	return s.done
+}
+
+// Data returns the event serial sent by the server with the reply. It must only be called
+// after Done has been closed.
+func (s *SyncRequest) Data() uint32 {
+	return s.data
+}
+
+// Cancel destroys the underlying callback. If the server hasn't replied yet, Done will
+// never be closed and the callback won't be called. Canceling a request whose reply has
+// already been dispatched, or is being dispatched by another goroutine, has no effect, and
+// neither has canceling it twice.
+func (s *SyncRequest) Cancel() {
+	s.mu.Lock()
+	if s.canceled || s.replied {
+		s.mu.Unlock()
+		return
+	}
+	s.canceled = true
+	s.mu.Unlock()
+	s.cb.Destroy()
+}
@@ -0,0 +1,71 @@
+package wayland
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestSyncRequestCancel(t *testing.T) {
+	_, dsp := newTestServer(t, nil)
+	dsp.StrictDestroy = true
+
+	var called bool
+	s := dsp.Sync(func(uint32) { called = true })
+	s.Cancel()
+	// Canceling twice isn't a double destroy.
+	s.Cancel()
+	roundtrip(t, dsp)
+	select {
+	case <-s.Done():
+		t.Error("Done was closed for a canceled request")
+	default:
+	}
+	if called {
+		t.Error("function of a canceled request was called")
+	}
+
+	// Canceling after the reply has no effect.
+	s = dsp.Sync(nil)
+	roundtrip(t, dsp)
+	<-s.Done()
+	s.Cancel()
+}
+
+func TestSyncRequestCancelConcurrent(t *testing.T) {
+	// Cancel races with the dispatcher delivering the reply. Run with -race.
+	_, dsp := newTestServer(t, nil)
+	dsp.StrictDestroy = true
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error)
+	go func() { ran <- dsp.Run(ctx) }()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				var data uint32
+				s := dsp.Sync(func(d uint32) { data = d + 1 })
+				s.Cancel()
+				select {
+				case <-s.Done():
+					if data == 0 {
+						t.Error("Done was closed without calling the function")
+					}
+				default:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	if err := <-ran; err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+	roundtrip(t, dsp)
+	if n := dsp.LiveProxies()["wl_callback"]; n != 0 {
+		t.Errorf("%d callbacks leaked", n)
+	}
+}
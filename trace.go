@@ -0,0 +1,167 @@
+package wayland
+
+// #include <wayland-client.h>
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"unsafe"
+)
+
+// TraceOptions configures protocol tracing. See Display.SetTrace.
+type TraceOptions struct {
+	// Logger receives the trace records.
+	Logger *slog.Logger
+	// Level is the level of the records. If it is nil, slog.LevelDebug is used.
+	Level slog.Leveler
+	// Interfaces limits tracing to messages of objects with the given interfaces, such as
+	// "wl_surface". If it is empty, all messages are traced.
+	Interfaces []string
+}
+
+type tracer struct {
+	logger *slog.Logger
+	level  slog.Leveler
+	ifaces map[string]struct{}
+}
+
+// SetTrace enables logging of all incoming events and outgoing requests, similar to
+// setting WAYLAND_DEBUG, but as structured records. Each record has the attributes
+// interface, id, message, and args, and the message "wayland event" or "wayland request".
+// Objects in args are formatted as interface@id. Passing nil disables tracing.
+//
+// Requests are traced by this package's request methods, so requests sent by other libraries
+// sharing the connection aren't traced. Events are traced when they are dispatched.
+//
+// SetTrace may be called at any time, from any goroutine.
+func (dsp *Display) SetTrace(opts *TraceOptions) {
+	if opts == nil || opts.Logger == nil {
+		dsp.tracer.Store(nil)
+		return
+	}
+	t := &tracer{
+		logger: opts.Logger,
+		level:  opts.Level,
+	}
+	if t.level == nil {
+		t.level = slog.LevelDebug
+	}
+	if len(opts.Interfaces) > 0 {
+		t.ifaces = make(map[string]struct{}, len(opts.Interfaces))
+		for _, iface := range opts.Interfaces {
+			t.ifaces[iface] = struct{}{}
+		}
+	}
+	dsp.tracer.Store(t)
+}
+
+func (t *tracer) enabled(iface string) bool {
+	if t == nil {
+		return false
+	}
+	if t.ifaces != nil {
+		if _, ok := t.ifaces[iface]; !ok {
+			return false
+		}
+	}
+	return t.logger.Enabled(context.Background(), t.level.Level())
+}
+
+func (t *tracer) log(msg string, iface string, id uint32, name string, args []any) {
+	t.logger.LogAttrs(context.Background(), t.level.Level(), msg,
+		slog.String("interface", iface),
+		slog.Uint64("id", uint64(id)),
+		slog.String("message", name),
+		slog.Any("args", args))
+}
+
+// traced reports whether requests of p are traced. It exists so that we don't collect
+// arguments when we don't have to.
+func (dsp *Display) traced(p Proxy) bool {
+	return dsp.tracer.Load().enabled(p.Interface())
+}
+
+// traceRequest traces the request name of p.
+func (dsp *Display) traceRequest(p Proxy, name string, args ...any) {
+	t := dsp.tracer.Load()
+	if t == nil {
+		return
+	}
+	for i, arg := range args {
+		args[i] = traceValue(arg)
+	}
+	t.log("wayland request", p.Interface(), p.ID(), name, args)
+}
+
+// traceDisplayRequest traces the request name of the wl_display object.
+func (dsp *Display) traceDisplayRequest(name string, args ...any) {
+	t := dsp.tracer.Load()
+	if !t.enabled("wl_display") {
+		return
+	}
+	for i, arg := range args {
+		args[i] = traceValue(arg)
+	}
+	t.log("wayland request", "wl_display", 1, name, args)
+}
+
+// traceValue formats proxies as interface@id.
+func traceValue(v any) any {
+	if p, ok := v.(Proxy); ok {
+		if reflect.ValueOf(p).IsNil() {
+			return "nil"
+		}
+		return fmt.Sprintf("%s@%d", p.Interface(), p.ID())
+	}
+	return v
+}
+
+// traceProxy formats a C proxy as interface@id.
+func traceProxy(proxy *C.struct_wl_proxy) string {
+	if proxy == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s@%d", C.GoString(C.wl_proxy_get_class(proxy)), C.wl_proxy_get_id(proxy))
+}
+
+// traceEvent traces an event, decoding its arguments according to the message's signature.
+func (t *tracer) traceEvent(target *C.struct_wl_proxy, msg *C.struct_wl_message, args *C.union_wl_argument) {
+	iface := C.GoString(C.wl_proxy_get_class(target))
+	if !t.enabled(iface) {
+		return
+	}
+	var out []any
+	i := 0
+	for _, c := range C.GoString(msg.signature) {
+		arg := unsafe.Add(unsafe.Pointer(args), i*len(C.union_wl_argument{}))
+		switch c {
+		case 'i':
+			out = append(out, *(*int32)(arg))
+		case 'u':
+			out = append(out, *(*uint32)(arg))
+		case 'f':
+			out = append(out, float64(*(*C.wl_fixed_t)(arg))/256)
+		case 's':
+			if s := *(**C.char)(arg); s != nil {
+				out = append(out, C.GoString(s))
+			} else {
+				out = append(out, nil)
+			}
+		case 'o', 'n':
+			out = append(out, traceProxy(*(**C.struct_wl_proxy)(arg)))
+		case 'a':
+			arr := *(**C.struct_wl_array)(arg)
+			out = append(out, fmt.Sprintf("array[%d]", arr.size))
+		case 'h':
+			out = append(out, fmt.Sprintf("fd %d", *(*int32)(arg)))
+		default:
+			// Nullability markers and versions
+			continue
+		}
+		i++
+	}
+	t.log("wayland event", iface, uint32(C.wl_proxy_get_id(target)), C.GoString(msg.name), out)
+}
@@ -0,0 +1,143 @@
+package wayland
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// traceRecord is a record logged by the tracer.
+type traceRecord struct {
+	msg     string
+	iface   string
+	id      uint32
+	message string
+	args    []any
+}
+
+// recordHandler is a slog.Handler that collects trace records.
+type recordHandler struct {
+	level slog.Level
+
+	mu      sync.Mutex
+	records []traceRecord
+}
+
+func (h *recordHandler) Enabled(_ context.Context, level slog.Level) bool { return level >= h.level }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler               { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler                    { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := traceRecord{msg: r.Message}
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "interface":
+			rec.iface = a.Value.String()
+		case "id":
+			rec.id = uint32(a.Value.Uint64())
+		case "message":
+			rec.message = a.Value.String()
+		case "args":
+			if args, _ := a.Value.Any().([]any); len(args) > 0 {
+				rec.args = args
+			}
+		}
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, rec)
+	return nil
+}
+
+func TestTracerEnabled(t *testing.T) {
+	debug := slog.New(&recordHandler{level: slog.LevelDebug})
+	info := slog.New(&recordHandler{level: slog.LevelInfo})
+	for _, tt := range []struct {
+		name  string
+		opts  *TraceOptions
+		iface string
+		want  bool
+	}{
+		{"disabled", nil, "wl_surface", false},
+		{"no logger", &TraceOptions{}, "wl_surface", false},
+		{"all interfaces", &TraceOptions{Logger: debug}, "wl_surface", true},
+		{"listed interface", &TraceOptions{Logger: debug, Interfaces: []string{"wl_output", "wl_surface"}}, "wl_surface", true},
+		{"unlisted interface", &TraceOptions{Logger: debug, Interfaces: []string{"wl_output"}}, "wl_surface", false},
+		{"default level below logger's", &TraceOptions{Logger: info}, "wl_surface", false},
+		{"level", &TraceOptions{Logger: info, Level: slog.LevelWarn}, "wl_surface", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var dsp Display
+			dsp.SetTrace(tt.opts)
+			if got := dsp.tracer.Load().enabled(tt.iface); got != tt.want {
+				t.Errorf("enabled(%q) = %t, want %t", tt.iface, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceEvents(t *testing.T) {
+	s, dsp := newTestServer(t, nil,
+		testGlobal{1, "wl_compositor", 6},
+		testGlobal{2, "wl_output", 2},
+		testGlobal{3, "zwp_linux_dmabuf_v1", 4})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	out := bindGlobal[*Output](t, dsp, 2, 2)
+	dmabuf := bindGlobal[*LinuxDmabuf](t, dsp, 3, 4)
+	surf := comp.CreateSurface()
+	fb, err := dmabuf.DefaultFeedback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &recordHandler{level: slog.LevelDebug}
+	dsp.SetTrace(&TraceOptions{
+		Logger:     slog.New(h),
+		Interfaces: []string{"wl_output", "wl_surface", "zwp_linux_dmabuf_feedback_v1"},
+	})
+	surf.Commit()
+	// Requests of other interfaces aren't traced.
+	comp.CreateSurface()
+	s.send(out.ID(), 0, int32(1), int32(2), int32(300), int32(200), int32(0), "make", "model", int32(0))
+	s.send(surf.ID(), 0, out.ID())
+	fd, size := formatTableFd(t, []DmabufFormat{{ShmFormatArgb8888, DmabufModifierLinear}})
+	s.send(fb.ID(), feedbackFormatTable, fd, size)
+	s.send(fb.ID(), feedbackMainDevice, devT(5))
+	roundtrip(t, dsp)
+	dsp.SetTrace(nil)
+	surf.Commit()
+	roundtrip(t, dsp)
+
+	outRef := fmt.Sprintf("wl_output@%d", out.ID())
+	want := []traceRecord{
+		{"wayland request", "wl_surface", surf.ID(), "commit", nil},
+		{"wayland event", "wl_output", out.ID(), "geometry", []any{int32(1), int32(2), int32(300), int32(200), int32(0), "make", "model", int32(0)}},
+		{"wayland event", "wl_surface", surf.ID(), "enter", []any{outRef}},
+		{"wayland event", "zwp_linux_dmabuf_feedback_v1", fb.ID(), "format_table", []any{"fd", size}},
+		{"wayland event", "zwp_linux_dmabuf_feedback_v1", fb.ID(), "main_device", []any{"array[8]"}},
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	got := h.records
+	for _, rec := range got {
+		// The client's file descriptor numbers vary.
+		if rec.message == "format_table" && len(rec.args) > 0 {
+			if s, ok := rec.args[0].(string); ok && strings.HasPrefix(s, "fd ") {
+				rec.args[0] = "fd"
+			}
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("record %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
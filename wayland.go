@@ -2,25 +2,75 @@
 
 // Only the subset of client API needed for Gutter has been bound. No thought has been
 // given to code generation or supporting arbitrary, user-supplied protocol extensions.
+//
+// # Concurrency
+//
+// A Display may be used from multiple goroutines. Creating and destroying proxies,
+// dispatching, and setting up event delivery (Listen, Subscribe, and so on) are safe to do
+// concurrently. A proxy created while its queue is being dispatched by another goroutine
+// doesn't miss any events, and callbacks and presentation feedback, which are destroyed
+// automatically after their last event, may be destroyed while that event is being
+// dispatched.
+//
+// The state of a proxy, including its On* fields, belongs to whoever dispatches the proxy's
+// event queue. Event handlers run on the goroutine dispatching the queue, and a queue must
+// only be dispatched by one goroutine at a time. To handle the events of some proxies on
+// another goroutine, assign them to their own EventQueue. Requests may be sent from any
+// goroutine, as libwayland serializes them, but a proxy must not be destroyed while it's
+// being used by another goroutine.
+//
+// PrepareRead, ReadEvents and CancelRead, as well as Run, which uses them, must only be used
+// by one goroutine at a time.
 package wayland
 
 // #cgo pkg-config: wayland-client wayland-egl
 // #include <stdlib.h>
+// #include <string.h>
 // #include <wayland-client.h>
 // #include "xdg-shell-client-protocol.h"
 // #include "xdg-decoration-client-protocol.h"
 // #include "wp-presentation-time-client-protocol.h"
 // #include "wp-viewporter-client-protocol.h"
 //
+// // proxy_tag marks the proxies created by this package. Its address is the tag.
+// static const char *const proxy_tag = "honnef.co/go/libwayland";
+// static const char *const *get_proxy_tag(void) { return &proxy_tag; }
+//
+// // destroy_new_proxy destroys a proxy that libwayland created for a new_id argument of an
+// // event that won't be delivered. The server-side object is destroyed with the interface's
+// // destroy request, if it has one.
+// static void destroy_new_proxy(struct wl_proxy *proxy, const struct wl_interface *iface) {
+// 	for (int i = 0; i < iface->method_count; i++) {
+// 		const struct wl_message *m = &iface->methods[i];
+// 		const char *sig = m->signature + strspn(m->signature, "0123456789");
+// 		int since = sig == m->signature ? 1 : atoi(m->signature);
+// 		if (strcmp(m->name, "destroy") == 0 && *sig == '\0' && since <= (int)wl_proxy_get_version(proxy)) {
+// 			wl_proxy_marshal_flags(proxy, i, NULL, wl_proxy_get_version(proxy), WL_MARSHAL_FLAG_DESTROY);
+// 			return;
+// 		}
+// 	}
+// 	wl_proxy_destroy(proxy);
+// }
+//
 // int dispatcher(void *user_data, void *target, uint32_t opcode, struct wl_message *msg, union wl_argument *args);
 import "C"
 
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"unicode"
 	"unsafe"
 
@@ -33,42 +83,263 @@ import (
 
 var CompositorInterface = &C.wl_compositor_interface
 var ShmInterface = &C.wl_shm_interface
+var OutputInterface = &C.wl_output_interface
 var XdgWmBaseInterface = &C.xdg_wm_base_interface
 var ZxdgDecorationManagerV1Interface = &C.zxdg_decoration_manager_v1_interface
 var WpPresentationInterface = &C.wp_presentation_interface
 var WpViewporterInterface = &C.wp_viewporter_interface
 
 type Display struct {
-	hnd     *C.struct_wl_display
-	proxies map[*C.struct_wl_proxy]any
-	pinner  runtime.Pinner
+	hnd *C.struct_wl_display
+	// queue is the state of the default event queue.
+	queue
+	// queues are the queues created with NewQueue.
+	queues map[*C.struct_wl_event_queue]*EventQueue
+	pinner runtime.Pinner
+
+	// mu protects queues, listeners, buffered, userData, and the links between surfaces and
+	// outputs.
+	mu sync.Mutex
 
 	prepared bool
+	// foreign is set for displays created with DisplayFromHandle.
+	foreign bool
+
+	// OnLeak, if set, is called by Disconnect if any proxies haven't been destroyed, with
+	// the number of live proxies by interface name. It is meant for catching leaks in tests.
+	OnLeak func(live map[string]int)
+
+	// StrictDestroy makes destroying an already destroyed proxy panic. By default, Destroy
+	// is idempotent.
+	StrictDestroy bool
+
+	// listeners and buffered implement the delivery of events as values; see Listen and
+	// BufferEvents.
+	listeners map[any]*eventListener
+	buffered  []Event
+
+	// userData is the data attached to proxies with SetUserData.
+	userData map[Proxy]map[reflect.Type]any
+
+	// tracer is the protocol tracer configured with SetTrace, or nil.
+	tracer atomic.Pointer[tracer]
+}
+
+// queue is the state needed for dispatching the events of an event queue. It is what the
+// dispatcher receives as its data.
+type queue struct {
+	// hnd is nil for the default queue. It has to be the first field; we pass a pointer to
+	// it to C as the dispatcher's data.
+	hnd *C.struct_wl_event_queue
+	dsp *Display
+	// mu protects proxies. Proxies are added and removed by whoever creates and destroys
+	// them, which needn't be the goroutine dispatching the queue.
+	mu sync.Mutex
+	// proxies maps the proxies assigned to the queue to their Go values.
+	proxies map[*C.struct_wl_proxy]any
+
+	// dispatchMu orders creating proxies with dispatching the queue. Sending a request that
+	// creates a proxy and setting the proxy's dispatcher aren't atomic, and libwayland drops
+	// events of proxies without a dispatcher. Creators hold the read lock until the proxy has
+	// been added; our dispatch functions hold the write lock while dispatching, except while
+	// event handlers run, as they may create proxies themselves.
+	dispatchMu sync.RWMutex
+	// dispatching is set while one of our dispatch functions dispatches the queue, as opposed
+	// to foreign code dispatching a display created with DisplayFromHandle. It is only
+	// accessed by the goroutine dispatching the queue.
+	dispatching bool
+
+	// panicked is the panic of an event handler during the current dispatch. It is only
+	// accessed by the goroutine dispatching the queue.
+	panicked *PanicError
+}
+
+// PanicError is the value the dispatch functions panic with when an event handler panicked.
+// Panics mustn't unwind through libwayland, so the dispatcher recovers them, skips the
+// remaining events of the dispatch, and lets the dispatch function re-panic once control is
+// back in Go.
+//
+// The skipped events are lost: their handlers won't be called, not even by later dispatches,
+// although objects destroyed by them are still cleaned up. For Roundtrip and RoundtripQueue,
+// this includes all events up to the server's reply.
+//
+// When foreign code dispatches a queue of a display created with DisplayFromHandle, there is
+// no dispatch function to re-panic, and a panicking handler crashes the program instead, like
+// a panic in a goroutine that doesn't recover.
+type PanicError struct {
+	// Value is the value the handler panicked with.
+	Value any
+	// Stack is the stack trace of the handler's goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic in event handler: %v\n\n%s", err.Value, err.Stack)
+}
+
+func (err *PanicError) Unwrap() error {
+	if err, ok := err.Value.(error); ok {
+		return err
+	}
+	return nil
+}
 
-	methods map[methodKey]reflect.Method
-	// space reused by dispatcher for creating call args
+// checkPanic re-panics with the panic of an event handler, if any.
+func (q *queue) checkPanic() {
+	if err := q.panicked; err != nil {
+		q.panicked = nil
+		panic(err)
+	}
+}
+
+// methods caches the event handler methods of internal types. It maps methodKey to
+// reflect.Method.
+var methods sync.Map
+
+// dispatchScratch is space reused by the dispatcher. Events can be dispatched on multiple
+// queues concurrently, so each call of the dispatcher gets its own.
+type dispatchScratch struct {
+	// space for creating call args
 	callArgs []reflect.Value
-	// space reused by dispatcher for computing method name
+	// space for computing method name
 	methName []byte
 }
 
+var dispatchScratchPool = sync.Pool{
+	New: func() any { return new(dispatchScratch) },
+}
+
+// creating prepares creating a proxy on q. The returned function has to be called once the
+// proxy has been added.
+func (q *queue) creating() func() {
+	q.dispatchMu.RLock()
+	return q.dispatchMu.RUnlock
+}
+
+// creating prepares creating a proxy with a request of parent. The new proxy is assigned to
+// parent's queue.
+func creating(parent Proxy) func() {
+	checkLive(parent)
+	return parent.display().queueOf((*C.struct_wl_proxy)(parent.Handle())).creating()
+}
+
+func (q *queue) init(dsp *Display) {
+	q.dsp = dsp
+	q.proxies = make(map[*C.struct_wl_proxy]any)
+}
+
 type methodKey struct {
 	typ  reflect.Type
 	name string
 }
 
+// Connect connects to the Wayland server named by the environment. It is equivalent to
+// ConnectTo("").
 func Connect() (*Display, error) {
-	dsp, err := C.wl_display_connect(nil)
+	return ConnectTo("")
+}
+
+// ConnectTo connects to the Wayland server listening on the socket called name. A relative
+// name is resolved relative to $XDG_RUNTIME_DIR; an absolute name is used as is. If name is
+// empty, $WAYLAND_DISPLAY is used, or wayland-0 if that isn't set either.
+//
+// Like libwayland, ConnectTo prefers a connection handed to the process via $WAYLAND_SOCKET
+// over connecting to a socket, regardless of name. The connection can only be used once, and
+// ConnectTo unsets the variable so that child processes don't inherit it.
+func ConnectTo(name string) (*Display, error) {
+	if fd, ok := os.LookupEnv("WAYLAND_SOCKET"); ok {
+		// libwayland unsets the variable in the C environment, but the Go runtime has its own
+		// copy.
+		defer os.Unsetenv("WAYLAND_SOCKET")
+		dsp, err := C.wl_display_connect(nil)
+		if dsp == nil {
+			return nil, connectError(fmt.Sprintf("couldn't connect to Wayland server via WAYLAND_SOCKET=%s", fd), err)
+		}
+		return newDisplay(dsp), nil
+	}
+
+	path, err := socketPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to Wayland server: %w", err)
+	}
+	var cname *C.char
+	if name != "" {
+		cname = C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	dsp, err := C.wl_display_connect(cname)
 	if dsp == nil {
-		return nil, fmt.Errorf("couldn't connect to Wayland server: %s", err)
+		return nil, connectError(fmt.Sprintf("couldn't connect to Wayland server at %s", path), err)
 	}
-	d := &Display{
-		hnd:     dsp,
-		proxies: make(map[*C.struct_wl_proxy]any),
-		methods: make(map[methodKey]reflect.Method),
+	return newDisplay(dsp), nil
+}
+
+// ConnectToFd connects to a Wayland server using an already connected socket, for example
+// one passed to the process by socket activation. The display takes ownership of fd, which
+// is closed by Disconnect.
+func ConnectToFd(fd uintptr) (*Display, error) {
+	dsp, err := C.wl_display_connect_to_fd(C.int(fd))
+	if dsp == nil {
+		return nil, connectError(fmt.Sprintf("couldn't connect to Wayland server via file descriptor %d", fd), err)
+	}
+	return newDisplay(dsp), nil
+}
+
+// connectError returns the error for a failed connection attempt. libwayland doesn't set
+// errno on all of its failure paths, in which case err is nil.
+func connectError(msg string, err error) error {
+	if err == nil {
+		return errors.New(msg)
 	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// DisplayFromHandle returns a Display for a connection owned by someone else, such as SDL,
+// GLFW or a GUI toolkit, so that it can be used to bind additional globals and create
+// objects alongside the other library. ptr must be a struct wl_display pointer. Disconnect
+// releases the Display without closing the connection.
+//
+// Proxies created by this package are tagged, and the dispatcher ignores events for
+// proxies that aren't. The owner of the connection usually dispatches the default queue
+// itself, so objects should be created on a queue of our own to avoid running event handlers
+// on the owner's thread:
+//
+//	q := dsp.NewQueue()
+//	reg := q.Registry()
+//	// ...
+//	dsp.RoundtripQueue(q)
+//
+// Queues dispatched by the owner aren't synchronized with creating proxies; proxies on those
+// queues should only be created on the thread that dispatches them.
+func DisplayFromHandle(ptr unsafe.Pointer) *Display {
+	d := newDisplay((*C.struct_wl_display)(ptr))
+	d.foreign = true
+	return d
+}
+
+func newDisplay(hnd *C.struct_wl_display) *Display {
+	d := &Display{hnd: hnd}
+	d.queue.init(d)
 	d.pinner.Pin(d)
-	return d, nil
+	return d
+}
+
+// socketPath resolves the name of a Wayland socket the same way libwayland does.
+func socketPath(name string) (string, error) {
+	if name == "" {
+		name = os.Getenv("WAYLAND_DISPLAY")
+	}
+	if name == "" {
+		name = "wayland-0"
+	}
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("XDG_RUNTIME_DIR isn't set, can't resolve socket %q", name)
+	}
+	return filepath.Join(dir, name), nil
 }
 
 func (dsp *Display) Handle() unsafe.Pointer {
@@ -79,7 +350,14 @@ func (dsp *Display) Disconnect() {
 	if dsp.hnd == nil {
 		panic("double close of wayland.Display")
 	}
-	C.wl_display_disconnect(dsp.hnd)
+	if dsp.OnLeak != nil {
+		if live := dsp.LiveProxies(); len(live) > 0 {
+			dsp.OnLeak(live)
+		}
+	}
+	if !dsp.foreign {
+		C.wl_display_disconnect(dsp.hnd)
+	}
 	dsp.hnd = nil
 	dsp.pinner.Unpin()
 }
@@ -128,76 +406,239 @@ func (dsp *Display) CancelReadIfPrepared() {
 	}
 }
 
+// DispatchPending dispatches events on the default queue without reading from the
+// connection. If an event handler panics, DispatchPending panics with a *PanicError.
 func (dsp *Display) DispatchPending() int {
-	n := int(C.wl_display_dispatch_pending(dsp.hnd))
+	n := dsp.queue.dispatchPending()
+	dsp.queue.checkPanic()
 	return n
 }
 
-func (dsp *Display) Dispatch() int {
-	n := int(C.wl_display_dispatch(dsp.hnd))
-	return n
+// Dispatch dispatches events on the default queue, blocking until there are some. It returns
+// the number of dispatched events, or an error if the connection failed. If an event handler
+// panics, Dispatch panics with a *PanicError.
+func (dsp *Display) Dispatch() (int, error) {
+	n, err := dsp.queue.dispatch()
+	dsp.queue.checkPanic()
+	return n, err
 }
 
+// Roundtrip blocks until the server has processed all requests sent so far, dispatching
+// events on the default queue. If an event handler panics, Roundtrip panics with a
+// *PanicError.
 func (dsp *Display) Roundtrip() (int, error) {
-	n, err := C.wl_display_roundtrip(dsp.hnd)
-	return int(n), err
+	n, err := dsp.queue.roundtrip(dsp.Sync(nil))
+	dsp.queue.checkPanic()
+	return n, err
 }
 
 func (dsp *Display) Registry() *Registry {
+	defer dsp.queue.creating()()
 	reg := &Registry{
 		dsp: dsp,
 		hnd: C.wl_display_get_registry(dsp.hnd),
 	}
 	dsp.add((*C.struct_wl_proxy)(reg.hnd), reg)
+	dsp.traceDisplayRequest("get_registry", reg)
 	return reg
 }
 
-func (dsp *Display) add(proxy *C.struct_wl_proxy, obj any) {
-	dsp.proxies[proxy] = obj
-	dsp.addDispatcher(proxy)
+// add registers a new proxy with the queue it has been assigned to, which is the queue of the
+// object that created it, and returns that queue. The creator has to hold the queue's
+// dispatch lock; see creating.
+func (dsp *Display) add(proxy *C.struct_wl_proxy, obj any) *queue {
+	q := dsp.queueOf(proxy)
+	q.mu.Lock()
+	q.proxies[proxy] = obj
+	q.mu.Unlock()
+	C.wl_proxy_set_tag(proxy, C.get_proxy_tag())
+	C.wl_proxy_add_dispatcher(proxy, (*[0]byte)(C.dispatcher), unsafe.Pointer(&q.hnd), nil)
+	return q
 }
 
-func (dsp *Display) addDispatcher(proxy *C.struct_wl_proxy) {
-	C.wl_proxy_add_dispatcher(proxy, (*[0]byte)(C.dispatcher), unsafe.Pointer(&dsp.hnd), nil)
+// ours reports whether proxy has been created by this package, as opposed to by another
+// library using the same connection.
+func ours(proxy *C.struct_wl_proxy) bool {
+	return C.wl_proxy_get_tag(proxy) == C.get_proxy_tag()
 }
 
+// forget unregisters a proxy. It has to be called before destroying the proxy.
 func (dsp *Display) forget(proxy *C.struct_wl_proxy) {
-	delete(dsp.proxies, proxy)
+	dsp.queueOf(proxy).forget(proxy)
+}
+
+// forget unregisters a proxy assigned to q. It reports whether the proxy was still
+// registered; when two goroutines race to destroy a proxy, only the one for which forget
+// returns true may destroy it.
+func (q *queue) forget(proxy *C.struct_wl_proxy) bool {
+	q.mu.Lock()
+	obj, ok := q.proxies[proxy]
+	delete(q.proxies, proxy)
+	q.mu.Unlock()
+	if ok {
+		dsp := q.dsp
+		dsp.mu.Lock()
+		delete(dsp.listeners, obj)
+		if p, ok := obj.(Proxy); ok {
+			delete(dsp.userData, p)
+		}
+		dsp.mu.Unlock()
+	}
+	return ok
+}
+
+func (dsp *Display) queueOf(proxy *C.struct_wl_proxy) *queue {
+	wlq := C.wl_proxy_get_queue(proxy)
+	dsp.mu.Lock()
+	defer dsp.mu.Unlock()
+	if q, ok := dsp.queues[wlq]; ok {
+		return &q.queue
+	}
+	return &dsp.queue
+}
+
+// lookup returns the Go value of a proxy on any queue.
+func (dsp *Display) lookup(proxy *C.struct_wl_proxy) (any, bool) {
+	if proxy == nil || !ours(proxy) {
+		return nil, false
+	}
+	return dsp.queueOf(proxy).get(proxy)
+}
+
+func (q *queue) get(proxy *C.struct_wl_proxy) (any, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	obj, ok := q.proxies[proxy]
+	return obj, ok
+}
+
+// LiveProxies returns the number of proxies that haven't been destroyed yet, by interface
+// name.
+func (dsp *Display) LiveProxies() map[string]int {
+	out := make(map[string]int)
+	count := func(q *queue) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for proxy := range q.proxies {
+			out[C.GoString(C.wl_proxy_get_class(proxy))]++
+		}
+	}
+	count(&dsp.queue)
+	dsp.mu.Lock()
+	queues := slices.Collect(maps.Values(dsp.queues))
+	dsp.mu.Unlock()
+	for _, q := range queues {
+		count(&q.queue)
+	}
+	return out
+}
+
+type eventKey struct {
+	// the interface's name, which is unique per interface
+	iface  *C.char
+	opcode uint32
+}
+
+// destructorEvents lists the events that end the lifetime of an object. The server has
+// destroyed the object when it sends them, and the client has to destroy its proxy.
+//
+// libwayland doesn't define constants for event opcodes; they are the events' indices in the
+// protocol.
+var destructorEvents = map[eventKey]struct{}{
+	{C.wl_callback_interface.name, 0}:              {}, // done
+	{C.wp_presentation_feedback_interface.name, 1}: {}, // presented
+	{C.wp_presentation_feedback_interface.name, 2}: {}, // discarded
+}
+
+func isDestructorEvent(proxy *C.struct_wl_proxy, opcode uint32) bool {
+	_, ok := destructorEvents[eventKey{C.wl_proxy_get_class(proxy), opcode}]
+	return ok
+}
+
+// destroyAfterEvent destroys proxy after it received a destructor event, unless the event
+// handler already destroyed it.
+func (q *queue) destroyAfterEvent(proxy *C.struct_wl_proxy) {
+	if q.forget(proxy) {
+		C.wl_proxy_destroy(proxy)
+	}
 }
 
 type Callback struct {
-	dsp    *Display
-	hnd    *C.struct_wl_callback
-	OnDone func(data uint32)
+	dsp *Display
+	// hnd is the *C.struct_wl_callback. It is accessed atomically, as the done event, which
+	// clears it, may be dispatched concurrently with Destroy.
+	hnd unsafe.Pointer
+	id  uint32
+	q   *queue
+	// destroyed is set by Destroy. The dispatcher destroying the proxy after the done event
+	// doesn't set it, so that Destroy can tell double destroys apart.
+	destroyed atomic.Bool
+	OnDone    func(data uint32)
+}
+
+// newCallback registers a callback created by a request.
+func (dsp *Display) newCallback(hnd *C.struct_wl_callback, fn func(data uint32)) *Callback {
+	cb := &Callback{
+		dsp:    dsp,
+		hnd:    unsafe.Pointer(hnd),
+		id:     uint32(C.wl_proxy_get_id((*C.struct_wl_proxy)(hnd))),
+		OnDone: fn,
+	}
+	cb.q = dsp.add((*C.struct_wl_proxy)(hnd), cb)
+	return cb
 }
 
 func (cb *Callback) internal() any {
 	return (*callback)(cb)
 }
 
+// Version returns 1, the only version of wl_callback.
+func (cb *Callback) Version() int { return 1 }
+
+func (cb *Callback) ID() uint32             { return cb.id }
+func (cb *Callback) Interface() string      { return "wl_callback" }
+func (cb *Callback) Handle() unsafe.Pointer { return atomic.LoadPointer(&cb.hnd) }
+func (cb *Callback) display() *Display      { return cb.dsp }
+
 func (cb *Callback) Destroy() {
-	C.wl_callback_destroy(cb.hnd)
-	cb.dsp.forget((*C.struct_wl_proxy)(cb.hnd))
-	cb.hnd = nil
+	if cb.destroyed.Swap(true) {
+		cb.dsp.destroyedTwice(cb)
+		return
+	}
+	hnd := (*C.struct_wl_callback)(atomic.SwapPointer(&cb.hnd, nil))
+	if hnd == nil {
+		// Already destroyed after receiving the done event.
+		return
+	}
+	// The dispatcher may be destroying the proxy after a done event concurrently. Whoever
+	// unregisters it first destroys it.
+	if cb.q.forget((*C.struct_wl_proxy)(hnd)) {
+		C.wl_callback_destroy(hnd)
+	}
 }
 
 type callback Callback
 
 func (cb *callback) Done(data uint32) {
-	(cb).OnDone(data)
-	(*Callback)(cb).Destroy()
-}
-
-func (dsp *Display) Sync(fn func(data uint32)) {
-	cb := &Callback{
-		dsp:    dsp,
-		hnd:    C.wl_display_sync(dsp.hnd),
-		OnDone: fn,
+	if cb.OnDone != nil {
+		cb.OnDone(data)
+	}
+	if cb.dsp.observed((*Callback)(cb)) {
+		cb.dsp.deliver((*Callback)(cb), CallbackDoneEvent{(*Callback)(cb), data})
 	}
-	dsp.add((*C.struct_wl_proxy)(cb.hnd), cb)
+	// The dispatcher destroys the proxy.
+	atomic.StorePointer(&cb.hnd, nil)
 }
 
-type Output uint32
+// Sync asks the server to call fn, which may be nil, once it has processed all requests sent
+// so far. The returned SyncRequest can be used to wait for the reply with select.
+func (dsp *Display) Sync(fn func(data uint32)) *SyncRequest {
+	defer dsp.queue.creating()()
+	cb := dsp.newCallback(C.wl_display_sync(dsp.hnd), nil)
+	s := newSyncRequest(cb, fn)
+	dsp.traceDisplayRequest("sync", cb)
+	return s
+}
 
 //export dispatcher
 func dispatcher(
@@ -208,21 +649,69 @@ func dispatcher(
 	msg *C.struct_wl_message,
 	args *C.union_wl_argument,
 ) C.int {
-	dsp := (*Display)(data)
-	sig := C.GoString(msg.signature)
-	obj := dsp.proxies[(*C.struct_wl_proxy)(target)]
+	q := (*queue)(data)
+	dsp := q.dsp
+	if q.dispatching {
+		// Let event handlers create proxies on this queue. The lock is taken again before
+		// libwayland dispatches the next event.
+		q.dispatchMu.Unlock()
+		defer q.dispatchMu.Lock()
+	}
+	if q.panicked != nil {
+		// A handler panicked earlier in this dispatch. The program's state is suspect, so
+		// we don't run any more handlers, but we still have to destroy proxies that the
+		// server has destroyed.
+		discardEvent(msg, args)
+		if isDestructorEvent((*C.struct_wl_proxy)(target), opcode) {
+			q.destroyAfterEvent((*C.struct_wl_proxy)(target))
+		}
+		return 0
+	}
+	// Panics mustn't unwind through libwayland's stack frames.
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*PanicError)
+			if !ok {
+				// Panics of nested dispatches have already been wrapped.
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+			if !q.dispatching {
+				// Foreign code is dispatching the queue. Nobody would re-panic, and the
+				// queue's events would be skipped forever.
+				go panic(err)
+				select {}
+			}
+			q.panicked = err
+		}
+	}()
+
+	if !ours((*C.struct_wl_proxy)(target)) {
+		// Not one of our proxies, even though it uses our dispatcher. Leave it alone.
+		return 0
+	}
+	obj, _ := q.get((*C.struct_wl_proxy)(target))
 	if obj == nil {
-		// XXX don't panic
-		panic("don't know this proxy")
+		// The proxy has been forgotten, but libwayland still had events queued for it.
+		discardEvent(msg, args)
+		return 0
+	}
+	if t := dsp.tracer.Load(); t != nil {
+		t.traceEvent((*C.struct_wl_proxy)(target), msg, args)
+	}
+	sig := C.GoString(msg.signature)
+	if isDestructorEvent((*C.struct_wl_proxy)(target), opcode) {
+		defer q.destroyAfterEvent((*C.struct_wl_proxy)(target))
 	}
 
 	n := safeish.FindNull(safeish.Cast[*byte](msg.name))
-	methNameB := dsp.methName
+	scratch := dispatchScratchPool.Get().(*dispatchScratch)
+	defer dispatchScratchPool.Put(scratch)
+	methNameB := scratch.methName
 	if cap(methNameB) >= n {
 		methNameB = methNameB[:n]
 	} else {
 		methNameB = make([]byte, n)
-		dsp.methName = methNameB[:0]
+		scratch.methName = methNameB[:0]
 	}
 	copy(methNameB, unsafe.Slice(safeish.Cast[*byte](msg.name), n))
 	// Wayland doesn't use Unicode in event names, so this is fine.
@@ -235,32 +724,42 @@ func dispatcher(
 	if inter, ok := obj.(internaler); ok {
 		internal := inter.internal()
 		typ := reflect.TypeOf(internal)
-		tmeth, ok := dsp.methods[methodKey{typ: typ, name: methName}]
-		if !ok {
+		var tmeth reflect.Method
+		if m, ok := methods.Load(methodKey{typ: typ, name: methName}); ok {
+			tmeth = m.(reflect.Method)
+		} else {
 			tmeth, ok = typ.MethodByName(methName)
 			if !ok {
 				// XXX don't panic
 				panic(fmt.Sprintf("couldn't find method %q on %T", methNameB, inter.internal()))
 			}
-			dsp.methods[methodKey{typ: typ, name: strings.Clone(methName)}] = tmeth
+			methods.Store(methodKey{typ: typ, name: strings.Clone(methName)}, tmeth)
 		}
 		meth = tmeth.Func
 		recv = reflect.ValueOf(internal)
 	} else {
 		meth = reflect.ValueOf(obj).Elem().FieldByName("On" + methName)
+		if !meth.IsValid() {
+			// Some fields use Go naming, such as OnGlobalRemove for global_remove.
+			meth = reflect.ValueOf(obj).Elem().FieldByName("On" + camelCase(methName))
+		}
 		if !meth.IsValid() {
 			// XXX don't panic
 			panic(fmt.Sprintf("couldn't find field %q on %T", "On"+methName, obj))
 		}
 	}
-	if meth.IsNil() {
-		// panic(fmt.Sprintln("no callback for", methName))
+	// Events of proxies without internal handlers are delivered as values here, which needs
+	// the arguments even if there's no callback.
+	deliverField := !recv.IsValid() && dsp.observed(obj)
+	if meth.IsNil() && !deliverField {
+		// Nobody takes ownership of the event's file descriptors and new objects.
+		discardEvent(msg, args)
 		return 0
 	}
 
 	var i int
 	var argOffset int
-	callArgs := dsp.callArgs[:0]
+	callArgs := scratch.callArgs[:0]
 	if recv.IsValid() {
 		i++
 		argOffset = -1
@@ -280,10 +779,18 @@ func dispatcher(
 		case 's':
 			callArgs = append(callArgs, reflect.ValueOf(C.GoString(*(**C.char)(arg))))
 		case 'o':
-			callArgs = append(callArgs, reflect.ValueOf(*(*uint32)(arg)).Convert(meth.Type().In(int(i))))
+			// Objects we don't know about, such as outputs the user didn't bind, are passed as
+			// nil.
+			typ := meth.Type().In(int(i))
+			if obj, ok := dsp.lookup(*(**C.struct_wl_proxy)(arg)); ok && reflect.TypeOf(obj).AssignableTo(typ) {
+				callArgs = append(callArgs, reflect.ValueOf(obj))
+			} else {
+				callArgs = append(callArgs, reflect.Zero(typ))
+			}
 		case 'n':
-			panic("n")
-			// XXX
+			// libwayland has already created the proxy for the new object; it's up to the
+			// event handler to wrap it.
+			callArgs = append(callArgs, reflect.ValueOf(unsafe.Pointer(*(**C.struct_wl_proxy)(arg))))
 		case 'a':
 			arr := *(**C.struct_wl_array)(arg)
 			// XXX make sure that calling Elem won't panic
@@ -293,6 +800,10 @@ func dispatcher(
 				callArgs = append(callArgs, reflect.ValueOf(unsafe.Slice((*int32)(arr.data), arr.size/4)))
 			case reflect.TypeOf(uint32(0)):
 				callArgs = append(callArgs, reflect.ValueOf(unsafe.Slice((*uint32)(arr.data), arr.size/4)))
+			case reflect.TypeOf(uint16(0)):
+				callArgs = append(callArgs, reflect.ValueOf(unsafe.Slice((*uint16)(arr.data), arr.size/2)))
+			case reflect.TypeOf(byte(0)):
+				callArgs = append(callArgs, reflect.ValueOf(unsafe.Slice((*byte)(arr.data), arr.size)))
 			default:
 				// XXX support all types we need
 				// XXX support convertible types
@@ -300,8 +811,8 @@ func dispatcher(
 			}
 
 		case 'h':
-			panic("h")
-			// XXX
+			// The handler takes ownership of the file descriptor.
+			callArgs = append(callArgs, reflect.ValueOf(*(*int32)(arg)).Convert(meth.Type().In(int(i))))
 		case '?':
 			continue
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
@@ -314,33 +825,142 @@ func dispatcher(
 	if !meth.IsNil() {
 		meth.Call(callArgs)
 	}
-	dsp.callArgs = callArgs[:0]
+	if deliverField {
+		dsp.deliverField(obj, methName, callArgs)
+	}
+	// Don't keep the arguments alive.
+	clear(callArgs)
+	scratch.callArgs = callArgs[:0]
 	return 0
 }
 
+// discardEvent releases what libwayland has allocated for the arguments of an event that
+// won't be delivered: it closes file descriptors and destroys the proxies of new objects.
+func discardEvent(msg *C.struct_wl_message, args *C.union_wl_argument) {
+	var i int
+	for _, c := range C.GoString(msg.signature) {
+		switch c {
+		case '?', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			continue
+		case 'h':
+			arg := unsafe.Add(unsafe.Pointer(args), i*len(C.union_wl_argument{}))
+			syscall.Close(int(*(*int32)(arg)))
+		case 'n':
+			arg := unsafe.Add(unsafe.Pointer(args), i*len(C.union_wl_argument{}))
+			if proxy := *(**C.struct_wl_proxy)(arg); proxy != nil {
+				iface := unsafe.Slice(msg.types, i+1)[i]
+				C.destroy_new_proxy(proxy, iface)
+			}
+		}
+		i++
+	}
+}
+
+// camelCase turns an event name like Global_remove into GlobalRemove.
+func camelCase(name string) string {
+	b := []byte(name)
+	out := b[:0]
+	upper := false
+	for _, c := range b {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			c = byte(unicode.ToUpper(rune(c)))
+			upper = false
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
 type Registry struct {
 	dsp *Display
 	hnd *C.struct_wl_registry
+	id  uint32
+	// advertised are the globals the server currently advertises, by name.
+	advertised map[uint32]advertisedGlobal
 
 	OnGlobal       func(name uint32, iface string, version uint32)
 	OnGlobalRemove func(name uint32)
 }
 
+type advertisedGlobal struct {
+	iface   string
+	version uint32
+}
+
+func (reg *Registry) internal() any {
+	return (*registry)(reg)
+}
+
+type registry Registry
+
+func (reg *registry) Global(name uint32, iface string, version uint32) {
+	if reg.advertised == nil {
+		reg.advertised = make(map[uint32]advertisedGlobal)
+	}
+	reg.advertised[name] = advertisedGlobal{iface, version}
+	if reg.OnGlobal != nil {
+		reg.OnGlobal(name, iface, version)
+	}
+	if reg.dsp.observed((*Registry)(reg)) {
+		reg.dsp.deliver((*Registry)(reg), RegistryGlobalEvent{(*Registry)(reg), name, iface, version})
+	}
+}
+
+func (reg *registry) Global_remove(name uint32) {
+	if reg.OnGlobalRemove != nil {
+		reg.OnGlobalRemove(name)
+	}
+	if reg.dsp.observed((*Registry)(reg)) {
+		reg.dsp.deliver((*Registry)(reg), RegistryGlobalRemoveEvent{(*Registry)(reg), name})
+	}
+	delete(reg.advertised, name)
+}
+
 type internaler interface {
 	internal() any
 }
 
+// Version returns 1, the only version of wl_registry.
+func (reg *Registry) Version() int { return 1 }
+
+func (reg *Registry) ID() uint32             { return proxyID(unsafe.Pointer(reg.hnd), reg.id) }
+func (reg *Registry) Interface() string      { return "wl_registry" }
+func (reg *Registry) Handle() unsafe.Pointer { return unsafe.Pointer(reg.hnd) }
+func (reg *Registry) display() *Display      { return reg.dsp }
+
 func (reg *Registry) Destroy() {
-	C.wl_registry_destroy(reg.hnd)
+	if reg.hnd == nil {
+		reg.dsp.destroyedTwice(reg)
+		return
+	}
+	reg.id = reg.ID()
 	reg.dsp.forget((*C.struct_wl_proxy)(reg.hnd))
+	C.wl_registry_destroy(reg.hnd)
 	reg.hnd = nil
 }
 
+// clampVersion limits vers to the highest version of iface that this package supports.
+// Binding a newer version would allow the server to send events we don't know about.
+func clampVersion(iface *C.struct_wl_interface, vers uint32) uint32 {
+	return min(vers, maxVersions[iface])
+}
+
 func (reg *Registry) bind(name uint32, iface *C.struct_wl_interface, vers uint32) *C.struct_wl_proxy {
-	return (*C.struct_wl_proxy)(C.wl_registry_bind(reg.hnd, C.uint(name), iface, C.uint(vers)))
+	checkLive(reg)
+	proxy := (*C.struct_wl_proxy)(C.wl_registry_bind(reg.hnd, C.uint(name), iface, C.uint(vers)))
+	if reg.dsp.traced(reg) {
+		reg.dsp.traceRequest(reg, "bind", name, C.GoString(iface.name), vers, traceProxy(proxy))
+	}
+	return proxy
 }
 
 func (reg *Registry) BindCompositor(name uint32, vers uint32) *Compositor {
+	vers = clampVersion(CompositorInterface, vers)
+	defer creating(reg)()
 	comp := &Compositor{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_wl_compositor)(reg.bind(name, CompositorInterface, vers)),
@@ -351,6 +971,8 @@ func (reg *Registry) BindCompositor(name uint32, vers uint32) *Compositor {
 }
 
 func (reg *Registry) BindShm(name uint32, vers uint32) *Shm {
+	vers = clampVersion(ShmInterface, vers)
+	defer creating(reg)()
 	shm := &Shm{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_wl_shm)(reg.bind(name, ShmInterface, vers)),
@@ -361,6 +983,8 @@ func (reg *Registry) BindShm(name uint32, vers uint32) *Shm {
 }
 
 func (reg *Registry) BindXdgWmBase(name uint32, vers uint32) *XdgWmBase {
+	vers = clampVersion(XdgWmBaseInterface, vers)
+	defer creating(reg)()
 	xdg := &XdgWmBase{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_xdg_wm_base)(reg.bind(name, XdgWmBaseInterface, vers)),
@@ -371,6 +995,8 @@ func (reg *Registry) BindXdgWmBase(name uint32, vers uint32) *XdgWmBase {
 }
 
 func (reg *Registry) BindZxdgDecorationManagerV1(name uint32, vers uint32) *XdgDecorationManager {
+	vers = clampVersion(ZxdgDecorationManagerV1Interface, vers)
+	defer creating(reg)()
 	xdg := &XdgDecorationManager{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_zxdg_decoration_manager_v1)(reg.bind(name, ZxdgDecorationManagerV1Interface, vers)),
@@ -381,6 +1007,8 @@ func (reg *Registry) BindZxdgDecorationManagerV1(name uint32, vers uint32) *XdgD
 }
 
 func (reg *Registry) BindWpPresentation(name uint32, vers uint32) *WpPresentation {
+	vers = clampVersion(WpPresentationInterface, vers)
+	defer creating(reg)()
 	out := &WpPresentation{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_wp_presentation)(reg.bind(name, WpPresentationInterface, vers)),
@@ -390,7 +1018,24 @@ func (reg *Registry) BindWpPresentation(name uint32, vers uint32) *WpPresentatio
 	return out
 }
 
+func (reg *Registry) BindOutput(name uint32, vers uint32) *Output {
+	vers = clampVersion(OutputInterface, vers)
+	defer creating(reg)()
+	out := &Output{
+		dsp:  reg.dsp,
+		hnd:  (*C.struct_wl_output)(reg.bind(name, OutputInterface, vers)),
+		vers: int(vers),
+		// Outputs that don't support the scale event have a scale of 1.
+		scale:        1,
+		pendingScale: 1,
+	}
+	reg.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
+	return out
+}
+
 func (reg *Registry) BindWpViewporter(name uint32, vers uint32) *WpViewporter {
+	vers = clampVersion(WpViewporterInterface, vers)
+	defer creating(reg)()
 	out := &WpViewporter{
 		dsp:  reg.dsp,
 		hnd:  (*C.struct_wp_viewporter)(reg.bind(name, WpViewporterInterface, vers)),
@@ -403,42 +1048,115 @@ func (reg *Registry) BindWpViewporter(name uint32, vers uint32) *WpViewporter {
 type WpPresentation struct {
 	dsp        *Display
 	hnd        *C.struct_wp_presentation
+	id         uint32
 	vers       int
+	clock      uint32
+	hasClock   bool
 	OnClock_id func(id uint)
 }
 
-func (p *WpPresentation) Version() int { return p.vers }
+func (p *WpPresentation) Version() int           { return p.vers }
+func (p *WpPresentation) ID() uint32             { return proxyID(unsafe.Pointer(p.hnd), p.id) }
+func (p *WpPresentation) Interface() string      { return "wp_presentation" }
+func (p *WpPresentation) Handle() unsafe.Pointer { return unsafe.Pointer(p.hnd) }
+func (p *WpPresentation) display() *Display      { return p.dsp }
+
+func (p *WpPresentation) internal() any {
+	return (*wpPresentation)(p)
+}
+
+type wpPresentation WpPresentation
+
+func (p *wpPresentation) Clock_id(id uint32) {
+	p.clock = id
+	p.hasClock = true
+	if p.OnClock_id != nil {
+		p.OnClock_id(uint(id))
+	}
+	if p.dsp.observed((*WpPresentation)(p)) {
+		p.dsp.deliver((*WpPresentation)(p), WpPresentationClockIDEvent{(*WpPresentation)(p), id})
+	}
+}
+
+// Clock returns the clock_gettime clock ID of the presentation clock. It is sent by the
+// compositor when binding, so it is only valid after a roundtrip.
+func (p *WpPresentation) Clock() uint32 { return p.clock }
 
 func (p *WpPresentation) Feedback(surface *Surface) *WpPresentationFeedback {
+	checkLive(p)
+	defer creating(p)()
+	checkLive(surface)
+	hnd := C.wp_presentation_feedback(p.hnd, surface.hnd)
 	out := &WpPresentationFeedback{
 		dsp:  p.dsp,
-		hnd:  C.wp_presentation_feedback(p.hnd, surface.hnd),
+		hnd:  unsafe.Pointer(hnd),
+		id:   uint32(C.wl_proxy_get_id((*C.struct_wl_proxy)(hnd))),
 		vers: p.vers,
+		pres: p,
+	}
+	out.q = p.dsp.add((*C.struct_wl_proxy)(hnd), out)
+	if p.dsp.traced(p) {
+		p.dsp.traceRequest(p, "feedback", surface, out)
 	}
-	p.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
 	return out
 }
 
 func (p *WpPresentation) Destroy() {
-	C.wp_presentation_destroy(p.hnd)
+	if p.hnd == nil {
+		p.dsp.destroyedTwice(p)
+		return
+	}
+	p.id = p.ID()
+	if p.dsp.traced(p) {
+		p.dsp.traceRequest(p, "destroy")
+	}
 	p.dsp.forget((*C.struct_wl_proxy)(p.hnd))
+	C.wp_presentation_destroy(p.hnd)
+	p.hnd = nil
 }
 
 type WpPresentationFeedback struct {
-	dsp          *Display
-	hnd          *C.struct_wp_presentation_feedback
-	vers         int
+	dsp *Display
+	// hnd is the *C.struct_wp_presentation_feedback. It is accessed atomically, as the
+	// presented and discarded events clear it.
+	hnd  unsafe.Pointer
+	id   uint32
+	vers int
+	q    *queue
+	// destroyed is set by Destroy, but not when the dispatcher destroys the proxy.
+	destroyed atomic.Bool
+	pres      *WpPresentation
+	// the output sent by sync_output, if any
+	output       *Output
 	OnSyncOutput func(*Output)
-	OnPresented  func(
-		tvSecHi, tvSecLo, tvNsec uint32,
-		refresh uint32,
-		seqHi, seqLo uint32,
-		flags uint32,
-	)
-	OnDiscarded func()
-}
-
-func (p *WpPresentationFeedback) Version() int { return p.vers }
+	OnPresented  func(info PresentationInfo)
+	OnDiscarded  func()
+}
+
+// PresentationInfo describes when and how a content update was presented.
+type PresentationInfo struct {
+	// Timestamp is the time at which the content update turned into light, in the clock
+	// domain identified by Clock.
+	Timestamp time.Duration
+	// Clock is the clock ID of the presentation clock, as announced by WpPresentation.
+	Clock uint32
+	// Refresh is the compositor's prediction of the time until the next output refresh
+	// after Timestamp. It is zero if the output has no constant refresh rate.
+	Refresh time.Duration
+	// MSC is the value of the output's vertical retrace counter when the update was first
+	// scanned out. It is zero if the output has no such counter.
+	MSC   uint64
+	Flags WpPresentationFeedbackKind
+	// SyncOutput is the output whose refresh cycle the presentation was synchronized to. It
+	// is nil if we haven't bound that output.
+	SyncOutput *Output
+}
+
+func (p *WpPresentationFeedback) Version() int           { return p.vers }
+func (p *WpPresentationFeedback) ID() uint32             { return p.id }
+func (p *WpPresentationFeedback) Interface() string      { return "wp_presentation_feedback" }
+func (p *WpPresentationFeedback) Handle() unsafe.Pointer { return atomic.LoadPointer(&p.hnd) }
+func (p *WpPresentationFeedback) display() *Display      { return p.dsp }
 
 func (p *WpPresentationFeedback) internal() any {
 	return (*wpPresentationFeedback)(p)
@@ -446,8 +1164,16 @@ func (p *WpPresentationFeedback) internal() any {
 
 type wpPresentationFeedback WpPresentationFeedback
 
-func (p *wpPresentationFeedback) SyncOutput(out *Output) {
-	p.OnSyncOutput(out)
+func (p *wpPresentationFeedback) Sync_output(out *Output) {
+	if p.output == nil {
+		p.output = out
+	}
+	if p.OnSyncOutput != nil {
+		p.OnSyncOutput(out)
+	}
+	if p.dsp.observed((*WpPresentationFeedback)(p)) {
+		p.dsp.deliver((*WpPresentationFeedback)(p), WpPresentationFeedbackSyncOutputEvent{(*WpPresentationFeedback)(p), out})
+	}
 }
 
 func (p *wpPresentationFeedback) Presented(
@@ -456,139 +1182,613 @@ func (p *wpPresentationFeedback) Presented(
 	seqHi, seqLo uint32,
 	flags uint32,
 ) {
-	p.OnPresented(
-		tvSecHi, tvSecLo, tvNsec,
-		refresh,
-		seqHi, seqLo,
-		flags,
-	)
-	p.dsp.forget((*C.struct_wl_proxy)(p.hnd))
+	observed := p.dsp.observed((*WpPresentationFeedback)(p))
+	if p.OnPresented != nil || observed {
+		sec := uint64(tvSecHi)<<32 | uint64(tvSecLo)
+		info := PresentationInfo{
+			Timestamp:  time.Duration(sec)*time.Second + time.Duration(tvNsec),
+			Clock:      p.pres.clock,
+			Refresh:    time.Duration(refresh),
+			MSC:        uint64(seqHi)<<32 | uint64(seqLo),
+			Flags:      WpPresentationFeedbackKind(flags),
+			SyncOutput: p.output,
+		}
+		if p.OnPresented != nil {
+			p.OnPresented(info)
+		}
+		if observed {
+			p.dsp.deliver((*WpPresentationFeedback)(p), WpPresentationFeedbackPresentedEvent{(*WpPresentationFeedback)(p), info})
+		}
+	}
+	// The dispatcher destroys the proxy.
+	atomic.StorePointer(&p.hnd, nil)
 }
 
 func (p *wpPresentationFeedback) Discarded() {
-	p.OnDiscarded()
-	p.dsp.forget((*C.struct_wl_proxy)(p.hnd))
+	if p.OnDiscarded != nil {
+		p.OnDiscarded()
+	}
+	if p.dsp.observed((*WpPresentationFeedback)(p)) {
+		p.dsp.deliver((*WpPresentationFeedback)(p), WpPresentationFeedbackDiscardedEvent{(*WpPresentationFeedback)(p)})
+	}
+	// The dispatcher destroys the proxy.
+	atomic.StorePointer(&p.hnd, nil)
+}
+
+// Destroy destroys the feedback before it has delivered its result. Feedback objects are
+// destroyed automatically after calling OnPresented or OnDiscarded.
+func (p *WpPresentationFeedback) Destroy() {
+	if p.destroyed.Swap(true) {
+		p.dsp.destroyedTwice(p)
+		return
+	}
+	hnd := (*C.struct_wp_presentation_feedback)(atomic.SwapPointer(&p.hnd, nil))
+	if hnd == nil {
+		// Already destroyed after receiving the presented or discarded event.
+		return
+	}
+	// As with Callback.Destroy, the dispatcher may be destroying the proxy concurrently.
+	if p.q.forget((*C.struct_wl_proxy)(hnd)) {
+		C.wp_presentation_feedback_destroy(hnd)
+	}
+}
+
+type Output struct {
+	dsp  *Display
+	hnd  *C.struct_wl_output
+	id   uint32
+	vers int
+	// scale is the output's scale as of the last done event; pendingScale is the scale
+	// that will be applied by the next one.
+	scale, pendingScale int32
+	// surfaces are the surfaces that are on this output.
+	surfaces map[*Surface]struct{}
+
+	OnGeometry    func(x, y, physicalWidth, physicalHeight, subpixel int32, make, model string, transform int32)
+	OnMode        func(flags uint32, width, height, refresh int32)
+	OnDone        func()
+	OnScale       func(factor int32)
+	OnName        func(name string)
+	OnDescription func(description string)
+}
+
+type output Output
+
+func (out *Output) internal() any {
+	return (*output)(out)
+}
+
+func (out *output) Geometry(x, y, physicalWidth, physicalHeight, subpixel int32, make, model string, transform int32) {
+	if out.OnGeometry != nil {
+		out.OnGeometry(x, y, physicalWidth, physicalHeight, subpixel, make, model, transform)
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputGeometryEvent{(*Output)(out), x, y, physicalWidth, physicalHeight, subpixel, make, model, transform})
+	}
+}
+
+func (out *output) Mode(flags uint32, width, height, refresh int32) {
+	if out.OnMode != nil {
+		out.OnMode(flags, width, height, refresh)
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputModeEvent{(*Output)(out), flags, width, height, refresh})
+	}
+}
+
+func (out *output) Done() {
+	var surfs []*Surface
+	out.dsp.mu.Lock()
+	if out.pendingScale != out.scale {
+		out.scale = out.pendingScale
+		surfs = slices.Collect(maps.Keys(out.surfaces))
+	}
+	out.dsp.mu.Unlock()
+	for _, surf := range surfs {
+		surf.updateScale()
+	}
+	if out.OnDone != nil {
+		out.OnDone()
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputDoneEvent{(*Output)(out)})
+	}
+}
+
+func (out *output) Scale(factor int32) {
+	out.pendingScale = factor
+	if out.OnScale != nil {
+		out.OnScale(factor)
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputScaleEvent{(*Output)(out), factor})
+	}
+}
+
+func (out *output) Name(name string) {
+	if out.OnName != nil {
+		out.OnName(name)
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputNameEvent{(*Output)(out), name})
+	}
+}
+
+func (out *output) Description(description string) {
+	if out.OnDescription != nil {
+		out.OnDescription(description)
+	}
+	if out.dsp.observed((*Output)(out)) {
+		out.dsp.deliver((*Output)(out), OutputDescriptionEvent{(*Output)(out), description})
+	}
+}
+
+func (out *Output) Version() int           { return out.vers }
+func (out *Output) ID() uint32             { return proxyID(unsafe.Pointer(out.hnd), out.id) }
+func (out *Output) Interface() string      { return "wl_output" }
+func (out *Output) Handle() unsafe.Pointer { return unsafe.Pointer(out.hnd) }
+func (out *Output) display() *Display      { return out.dsp }
+
+// Scale returns the output's scale factor, as of the most recent done event.
+func (out *Output) Scale() int {
+	out.dsp.mu.Lock()
+	defer out.dsp.mu.Unlock()
+	return int(out.scale)
+}
+
+// Destroy releases the output, using the release request if the bound version supports it.
+func (out *Output) Destroy() {
+	if out.hnd == nil {
+		out.dsp.destroyedTwice(out)
+		return
+	}
+	out.id = out.ID()
+	if out.vers >= C.WL_OUTPUT_RELEASE_SINCE_VERSION && out.dsp.traced(out) {
+		out.dsp.traceRequest(out, "release")
+	}
+	out.dsp.forget((*C.struct_wl_proxy)(out.hnd))
+	if out.vers >= C.WL_OUTPUT_RELEASE_SINCE_VERSION {
+		C.wl_output_release(out.hnd)
+	} else {
+		C.wl_output_destroy(out.hnd)
+	}
+	out.hnd = nil
+	out.dsp.mu.Lock()
+	var surfs []*Surface
+	for surf := range out.surfaces {
+		if surf.removeOutput(out) {
+			surfs = append(surfs, surf)
+		}
+	}
+	out.surfaces = nil
+	out.dsp.mu.Unlock()
+	for _, surf := range surfs {
+		surf.updateScale()
+	}
 }
 
 type Compositor struct {
 	dsp  *Display
 	hnd  *C.struct_wl_compositor
+	id   uint32
 	vers int
 }
 
-func (comp *Compositor) Version() int { return comp.vers }
+func (comp *Compositor) Version() int           { return comp.vers }
+func (comp *Compositor) ID() uint32             { return proxyID(unsafe.Pointer(comp.hnd), comp.id) }
+func (comp *Compositor) Interface() string      { return "wl_compositor" }
+func (comp *Compositor) Handle() unsafe.Pointer { return unsafe.Pointer(comp.hnd) }
+func (comp *Compositor) display() *Display      { return comp.dsp }
 
 func (comp *Compositor) CreateSurface() *Surface {
+	checkLive(comp)
+	defer creating(comp)()
 	surf := &Surface{
 		dsp:  comp.dsp,
 		hnd:  C.wl_compositor_create_surface(comp.hnd),
 		vers: comp.vers,
 	}
 	comp.dsp.add((*C.struct_wl_proxy)(surf.hnd), surf)
+	if comp.dsp.traced(comp) {
+		comp.dsp.traceRequest(comp, "create_surface", surf)
+	}
 	return surf
 }
 
 func (comp *Compositor) Destroy() {
-	C.wl_compositor_destroy(comp.hnd)
+	if comp.hnd == nil {
+		comp.dsp.destroyedTwice(comp)
+		return
+	}
+	comp.id = comp.ID()
 	comp.dsp.forget((*C.struct_wl_proxy)(comp.hnd))
+	C.wl_compositor_destroy(comp.hnd)
+	comp.hnd = nil
 }
 
 type Surface struct {
 	dsp  *Display
 	hnd  *C.struct_wl_surface
+	id   uint32
 	vers int
+	// outputs are the outputs the surface is on, in the order it entered them.
+	outputs []*Output
+	// preferredScale is the most recent preferred buffer scale, or 0.
+	preferredScale int
+	// tracker is the surface's ScaleTracker, if any.
+	tracker *ScaleTracker
+	// Outputs and surfaces may be on different queues, so the fields above are protected by
+	// dsp.mu.
+
+	// frame is the frame callback requested with RequestFrame since the last commit. Requests
+	// may be sent from any goroutine, so it is protected by frameMu.
+	frame   *frameCallback
+	frameMu sync.Mutex
+
+	OnEnter                      func(out *Output)
+	OnLeave                      func(out *Output)
+	OnPreferred_buffer_scale     func(scale int)
+	OnPreferred_buffer_transform func(transform uint32)
+}
+
+type surface Surface
+
+func (surf *Surface) internal() any {
+	return (*surface)(surf)
+}
+
+func (surf *surface) Enter(out *Output) {
+	// Outputs the user didn't bind are passed as nil. We can't track those.
+	if out != nil {
+		surf.dsp.mu.Lock()
+		surf.outputs = append(surf.outputs, out)
+		if out.surfaces == nil {
+			out.surfaces = make(map[*Surface]struct{})
+		}
+		out.surfaces[(*Surface)(surf)] = struct{}{}
+		surf.dsp.mu.Unlock()
+		(*Surface)(surf).updateScale()
+	}
+	if surf.OnEnter != nil {
+		surf.OnEnter(out)
+	}
+	if surf.dsp.observed((*Surface)(surf)) {
+		surf.dsp.deliver((*Surface)(surf), SurfaceEnterEvent{(*Surface)(surf), out})
+	}
+}
 
-	OnPreferred_buffer_scale func(scale int)
+func (surf *surface) Leave(out *Output) {
+	if out != nil {
+		surf.dsp.mu.Lock()
+		delete(out.surfaces, (*Surface)(surf))
+		removed := (*Surface)(surf).removeOutput(out)
+		surf.dsp.mu.Unlock()
+		if removed {
+			(*Surface)(surf).updateScale()
+		}
+	}
+	if surf.OnLeave != nil {
+		surf.OnLeave(out)
+	}
+	if surf.dsp.observed((*Surface)(surf)) {
+		surf.dsp.deliver((*Surface)(surf), SurfaceLeaveEvent{(*Surface)(surf), out})
+	}
 }
 
-func (surf *Surface) Version() int { return surf.vers }
+func (surf *surface) Preferred_buffer_scale(scale int) {
+	surf.dsp.mu.Lock()
+	surf.preferredScale = scale
+	surf.dsp.mu.Unlock()
+	(*Surface)(surf).updateScale()
+	if surf.OnPreferred_buffer_scale != nil {
+		surf.OnPreferred_buffer_scale(scale)
+	}
+	if surf.dsp.observed((*Surface)(surf)) {
+		surf.dsp.deliver((*Surface)(surf), SurfacePreferredBufferScaleEvent{(*Surface)(surf), scale})
+	}
+}
+
+func (surf *surface) Preferred_buffer_transform(transform uint32) {
+	if surf.OnPreferred_buffer_transform != nil {
+		surf.OnPreferred_buffer_transform(transform)
+	}
+	if surf.dsp.observed((*Surface)(surf)) {
+		surf.dsp.deliver((*Surface)(surf), SurfacePreferredBufferTransformEvent{(*Surface)(surf), transform})
+	}
+}
+
+// removeOutput removes out from the surface's outputs and reports whether it was there.
+// surf.dsp.mu must be held.
+func (surf *Surface) removeOutput(out *Output) bool {
+	if i := slices.Index(surf.outputs, out); i != -1 {
+		surf.outputs = slices.Delete(surf.outputs, i, i+1)
+		return true
+	}
+	return false
+}
+
+func (surf *Surface) updateScale() {
+	surf.dsp.mu.Lock()
+	t := surf.tracker
+	surf.dsp.mu.Unlock()
+	if t != nil {
+		t.update()
+	}
+}
+
+func (surf *Surface) Version() int      { return surf.vers }
+func (surf *Surface) ID() uint32        { return proxyID(unsafe.Pointer(surf.hnd), surf.id) }
+func (surf *Surface) Interface() string { return "wl_surface" }
+func (surf *Surface) display() *Display { return surf.dsp }
+
+// Outputs returns the bound outputs the surface is on.
+func (surf *Surface) Outputs() []*Output {
+	surf.dsp.mu.Lock()
+	defer surf.dsp.mu.Unlock()
+	return slices.Clone(surf.outputs)
+}
 
 func (surf *Surface) Handle() unsafe.Pointer {
 	return unsafe.Pointer(surf.hnd)
 }
 
+// Destroy destroys the surface and its ScaleTracker, if any.
 func (surf *Surface) Destroy() {
-	C.wl_surface_destroy(surf.hnd)
+	if surf.hnd == nil {
+		surf.dsp.destroyedTwice(surf)
+		return
+	}
+	surf.dsp.mu.Lock()
+	t := surf.tracker
+	surf.dsp.mu.Unlock()
+	if t != nil {
+		// The surface's wp_fractional_scale_v1 object goes first.
+		t.Destroy()
+	}
+	surf.id = surf.ID()
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "destroy")
+	}
 	surf.dsp.forget((*C.struct_wl_proxy)(surf.hnd))
+	C.wl_surface_destroy(surf.hnd)
+	surf.hnd = nil
+	surf.dsp.mu.Lock()
+	defer surf.dsp.mu.Unlock()
+	for _, out := range surf.outputs {
+		delete(out.surfaces, surf)
+	}
+	surf.outputs = nil
 }
 
+// Attach attaches buf as the surface's next content. A nil buffer unmaps the surface.
 func (surf *Surface) Attach(buf *Buffer) {
-	C.wl_surface_attach(surf.hnd, buf.hnd, 0, 0)
+	checkLive(surf)
+	var hnd *C.struct_wl_buffer
+	if buf != nil {
+		checkLive(buf)
+		hnd = buf.hnd
+	}
+	C.wl_surface_attach(surf.hnd, hnd, 0, 0)
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "attach", buf, 0, 0)
+	}
 }
 
-func (surf *Surface) SetBufferScale(scale int) {
+// SetBufferScale sets the scale of attached buffers. It requires version 3.
+func (surf *Surface) SetBufferScale(scale int) error {
+	checkLive(surf)
+	if err := checkVersion(surf, "set_buffer_scale", C.WL_SURFACE_SET_BUFFER_SCALE_SINCE_VERSION); err != nil {
+		return err
+	}
 	C.wl_surface_set_buffer_scale(surf.hnd, C.int32_t(scale))
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "set_buffer_scale", scale)
+	}
+	return nil
 }
 
 func (surf *Surface) Damage(x, y, width, height int32) {
+	checkLive(surf)
 	C.wl_surface_damage(surf.hnd, C.int(x), C.int(y), C.int(width), C.int(height))
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "damage", x, y, width, height)
+	}
 }
 
-func (surf *Surface) Frame(fn func(data uint32)) {
-	cb := &Callback{
-		dsp:    surf.dsp,
-		hnd:    C.wl_surface_frame(surf.hnd),
-		OnDone: fn,
+// Frame requests a frame callback for the next commit. The callback is destroyed after fn has
+// been called, or can be destroyed early to cancel the request.
+// Unlike RequestFrame, each call creates a new wl_callback.
+func (surf *Surface) Frame(fn func(data uint32)) *Callback {
+	checkLive(surf)
+	defer creating(surf)()
+	cb := surf.dsp.newCallback(C.wl_surface_frame(surf.hnd), fn)
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "frame", cb)
 	}
-	surf.dsp.add((*C.struct_wl_proxy)(cb.hnd), cb)
+	return cb
 }
 
 func (surf *Surface) Commit() {
+	checkLive(surf)
+	surf.frameMu.Lock()
+	defer surf.frameMu.Unlock()
+	// Frame requests made after this commit need a new callback.
+	surf.frame = nil
 	C.wl_surface_commit(surf.hnd)
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "commit")
+	}
 }
 
 type Shm struct {
 	dsp  *Display
 	hnd  *C.struct_wl_shm
+	id   uint32
 	vers int
-	// XXX format should be of type SHmFormat, but for that we have to improve our
-	// reflection.
-	OnFormat func(format uint32)
+	// formats collects the formats advertised by the compositor.
+	formats  map[ShmFormat]struct{}
+	OnFormat func(format ShmFormat)
+}
+
+func (shm *Shm) Version() int           { return shm.vers }
+func (shm *Shm) ID() uint32             { return proxyID(unsafe.Pointer(shm.hnd), shm.id) }
+func (shm *Shm) Interface() string      { return "wl_shm" }
+func (shm *Shm) Handle() unsafe.Pointer { return unsafe.Pointer(shm.hnd) }
+func (shm *Shm) display() *Display      { return shm.dsp }
+
+func (shm *Shm) internal() any {
+	return (*shmInternal)(shm)
 }
 
-func (shm *Shm) Version() int { return shm.vers }
+type shmInternal Shm
+
+func (shm *shmInternal) Format(format ShmFormat) {
+	if shm.formats == nil {
+		shm.formats = make(map[ShmFormat]struct{})
+	}
+	shm.formats[format] = struct{}{}
+	if shm.OnFormat != nil {
+		shm.OnFormat(format)
+	}
+	if shm.dsp.observed((*Shm)(shm)) {
+		shm.dsp.deliver((*Shm)(shm), ShmFormatEvent{(*Shm)(shm), format})
+	}
+}
+
+// Supports reports whether the compositor supports format. Formats are advertised after
+// binding, so the result is only meaningful after a roundtrip. ShmFormatArgb8888 and
+// ShmFormatXrgb8888 are always supported.
+func (shm *Shm) Supports(format ShmFormat) bool {
+	if format == ShmFormatArgb8888 || format == ShmFormatXrgb8888 {
+		return true
+	}
+	_, ok := shm.formats[format]
+	return ok
+}
+
+// Best returns the first format in preferences that the compositor supports. If none are
+// supported, it returns false.
+func (shm *Shm) Best(preferences ...ShmFormat) (ShmFormat, bool) {
+	for _, f := range preferences {
+		if shm.Supports(f) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// Formats returns the formats advertised by the compositor, in ascending order.
+func (shm *Shm) Formats() []ShmFormat {
+	out := make([]ShmFormat, 0, len(shm.formats))
+	for f := range shm.formats {
+		out = append(out, f)
+	}
+	slices.Sort(out)
+	return out
+}
 
 func (shm *Shm) Destroy() {
-	C.wl_shm_destroy(shm.hnd)
+	if shm.hnd == nil {
+		shm.dsp.destroyedTwice(shm)
+		return
+	}
+	shm.id = shm.ID()
 	shm.dsp.forget((*C.struct_wl_proxy)(shm.hnd))
+	C.wl_shm_destroy(shm.hnd)
+	shm.hnd = nil
 }
 
 func (shm *Shm) CreatePool(fd int32, sz int32) *ShmPool {
+	checkLive(shm)
+	defer creating(shm)()
 	pool := &ShmPool{
 		dsp:  shm.dsp,
 		hnd:  C.wl_shm_create_pool(shm.hnd, C.int(fd), C.int(sz)),
 		vers: shm.vers,
 	}
 	shm.dsp.add((*C.struct_wl_proxy)(pool.hnd), pool)
+	if shm.dsp.traced(shm) {
+		shm.dsp.traceRequest(shm, "create_pool", pool, fd, sz)
+	}
 	return pool
 }
 
 type ShmPool struct {
 	dsp  *Display
 	hnd  *C.struct_wl_shm_pool
+	id   uint32
 	vers int
 }
 
-func (pool *ShmPool) Version() int { return pool.vers }
+func (pool *ShmPool) Version() int           { return pool.vers }
+func (pool *ShmPool) ID() uint32             { return proxyID(unsafe.Pointer(pool.hnd), pool.id) }
+func (pool *ShmPool) Interface() string      { return "wl_shm_pool" }
+func (pool *ShmPool) Handle() unsafe.Pointer { return unsafe.Pointer(pool.hnd) }
+func (pool *ShmPool) display() *Display      { return pool.dsp }
 
 func (pool *ShmPool) Destroy() {
-	C.wl_shm_pool_destroy(pool.hnd)
+	if pool.hnd == nil {
+		pool.dsp.destroyedTwice(pool)
+		return
+	}
+	pool.id = pool.ID()
+	if pool.dsp.traced(pool) {
+		pool.dsp.traceRequest(pool, "destroy")
+	}
 	pool.dsp.forget((*C.struct_wl_proxy)(pool.hnd))
+	C.wl_shm_pool_destroy(pool.hnd)
+	pool.hnd = nil
 }
 
 func (pool *ShmPool) CreateBuffer(offset, width, height, stride int32, format ShmFormat) *Buffer {
+	checkLive(pool)
+	defer creating(pool)()
 	buf := &Buffer{
 		dsp:  pool.dsp,
 		hnd:  C.wl_shm_pool_create_buffer(pool.hnd, C.int(offset), C.int(width), C.int(height), C.int(stride), C.uint(format)),
 		vers: pool.vers,
 	}
 	pool.dsp.add((*C.struct_wl_proxy)(buf.hnd), buf)
+	if pool.dsp.traced(pool) {
+		pool.dsp.traceRequest(pool, "create_buffer", buf, offset, width, height, stride, format)
+	}
 	return buf
 }
 
 //go:generate stringer -type ShmFormat
 type ShmFormat uint32
 
+// DRM fourcc codes of the two formats whose ShmFormat values differ from their fourcc codes.
+const (
+	fourccArgb8888 = 0x34325241
+	fourccXrgb8888 = 0x34325258
+)
+
+// Fourcc returns the DRM fourcc code of the format, as used by linux-dmabuf. It is identical to
+// the ShmFormat value for all formats but ShmFormatArgb8888 and ShmFormatXrgb8888.
+func (f ShmFormat) Fourcc() uint32 {
+	switch f {
+	case ShmFormatArgb8888:
+		return fourccArgb8888
+	case ShmFormatXrgb8888:
+		return fourccXrgb8888
+	default:
+		return uint32(f)
+	}
+}
+
+// ShmFormatFromFourcc returns the ShmFormat corresponding to a DRM fourcc code.
+func ShmFormatFromFourcc(code uint32) ShmFormat {
+	switch code {
+	case fourccArgb8888:
+		return ShmFormatArgb8888
+	case fourccXrgb8888:
+		return ShmFormatXrgb8888
+	default:
+		return ShmFormat(code)
+	}
+}
+
 const (
 	ShmFormatArgb8888             ShmFormat = 0          // 32-bit ARGB format, [31:0] A:R:G:B 8:8:8:8 little endian
 	ShmFormatXrgb8888             ShmFormat = 1          // 32-bit RGB format, [31:0] x:R:G:B 8:8:8:8 little endian
@@ -703,170 +1903,389 @@ const (
 type Buffer struct {
 	dsp       *Display
 	hnd       *C.struct_wl_buffer
+	id        uint32
 	vers      int
 	OnRelease func()
 }
 
-func (buf *Buffer) Version() int { return buf.vers }
+func (buf *Buffer) Version() int           { return buf.vers }
+func (buf *Buffer) ID() uint32             { return proxyID(unsafe.Pointer(buf.hnd), buf.id) }
+func (buf *Buffer) Interface() string      { return "wl_buffer" }
+func (buf *Buffer) Handle() unsafe.Pointer { return unsafe.Pointer(buf.hnd) }
+func (buf *Buffer) display() *Display      { return buf.dsp }
 
 func (buf *Buffer) Destroy() {
-	C.wl_buffer_destroy(buf.hnd)
+	if buf.hnd == nil {
+		buf.dsp.destroyedTwice(buf)
+		return
+	}
+	buf.id = buf.ID()
+	if buf.dsp.traced(buf) {
+		buf.dsp.traceRequest(buf, "destroy")
+	}
 	buf.dsp.forget((*C.struct_wl_proxy)(buf.hnd))
+	C.wl_buffer_destroy(buf.hnd)
+	buf.hnd = nil
 }
 
 type XdgWmBase struct {
 	dsp    *Display
 	hnd    *C.struct_xdg_wm_base
+	id     uint32
 	vers   int
 	OnPing func(serial uint32)
 }
 
-func (xdg *XdgWmBase) Version() int { return xdg.vers }
+func (xdg *XdgWmBase) Version() int           { return xdg.vers }
+func (xdg *XdgWmBase) ID() uint32             { return proxyID(unsafe.Pointer(xdg.hnd), xdg.id) }
+func (xdg *XdgWmBase) Interface() string      { return "xdg_wm_base" }
+func (xdg *XdgWmBase) Handle() unsafe.Pointer { return unsafe.Pointer(xdg.hnd) }
+func (xdg *XdgWmBase) display() *Display      { return xdg.dsp }
 
 func (xdg *XdgWmBase) Destroy() {
-	C.xdg_wm_base_destroy(xdg.hnd)
+	if xdg.hnd == nil {
+		xdg.dsp.destroyedTwice(xdg)
+		return
+	}
+	xdg.id = xdg.ID()
+	if xdg.dsp.traced(xdg) {
+		xdg.dsp.traceRequest(xdg, "destroy")
+	}
 	xdg.dsp.forget((*C.struct_wl_proxy)(xdg.hnd))
+	C.xdg_wm_base_destroy(xdg.hnd)
+	xdg.hnd = nil
 }
 
 func (xdg *XdgWmBase) XdgSurface(surf *Surface) *XdgSurface {
+	checkLive(xdg)
+	defer creating(xdg)()
+	checkLive(surf)
 	xdgSurf := &XdgSurface{
 		dsp:  xdg.dsp,
 		hnd:  C.xdg_wm_base_get_xdg_surface(xdg.hnd, surf.hnd),
 		vers: xdg.vers,
 	}
 	xdg.dsp.add((*C.struct_wl_proxy)(xdgSurf.hnd), xdgSurf)
+	if xdg.dsp.traced(xdg) {
+		xdg.dsp.traceRequest(xdg, "get_xdg_surface", xdgSurf, surf)
+	}
 	return xdgSurf
 }
 
 func (xdg *XdgWmBase) Pong(serial uint32) {
+	checkLive(xdg)
 	C.xdg_wm_base_pong(xdg.hnd, C.uint32_t(serial))
+	if xdg.dsp.traced(xdg) {
+		xdg.dsp.traceRequest(xdg, "pong", serial)
+	}
 }
 
 type XdgSurface struct {
 	dsp         *Display
 	hnd         *C.struct_xdg_surface
+	id          uint32
 	vers        int
 	OnConfigure func(serial uint32)
 }
 
-func (surf *XdgSurface) Version() int { return surf.vers }
+func (surf *XdgSurface) Version() int           { return surf.vers }
+func (surf *XdgSurface) ID() uint32             { return proxyID(unsafe.Pointer(surf.hnd), surf.id) }
+func (surf *XdgSurface) Interface() string      { return "xdg_surface" }
+func (surf *XdgSurface) Handle() unsafe.Pointer { return unsafe.Pointer(surf.hnd) }
+func (surf *XdgSurface) display() *Display      { return surf.dsp }
 
 func (surf *XdgSurface) Destroy() {
-	C.xdg_surface_destroy(surf.hnd)
+	if surf.hnd == nil {
+		surf.dsp.destroyedTwice(surf)
+		return
+	}
+	surf.id = surf.ID()
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "destroy")
+	}
 	surf.dsp.forget((*C.struct_wl_proxy)(surf.hnd))
+	C.xdg_surface_destroy(surf.hnd)
+	surf.hnd = nil
 }
 
 func (surf *XdgSurface) Toplevel() *XdgToplevel {
+	checkLive(surf)
+	defer creating(surf)()
 	top := &XdgToplevel{
 		dsp:  surf.dsp,
 		hnd:  C.xdg_surface_get_toplevel(surf.hnd),
 		vers: surf.vers,
 	}
 	surf.dsp.add((*C.struct_wl_proxy)(top.hnd), top)
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "get_toplevel", top)
+	}
 	return top
 }
 
 func (surf *XdgSurface) AckConfigure(serial uint32) {
+	checkLive(surf)
 	C.xdg_surface_ack_configure(surf.hnd, C.uint(serial))
+	if surf.dsp.traced(surf) {
+		surf.dsp.traceRequest(surf, "ack_configure", serial)
+	}
 }
 
 type XdgToplevel struct {
-	dsp               *Display
-	hnd               *C.struct_xdg_toplevel
-	vers              int
-	OnConfigure       func(width, height int32, states []uint32)
-	OnClose           func()
+	dsp         *Display
+	hnd         *C.struct_xdg_toplevel
+	id          uint32
+	vers        int
+	OnConfigure func(width, height int32, states []uint32)
+	OnClose     func()
+	// OnConfigureBounds is only called by version 4 and newer. It suggests the maximum size
+	// of the window, such as the size of the output's work area.
+	OnConfigureBounds func(width, height int32)
+	// OnWm_capabilities is only called by version 5 and newer; older compositors support
+	// all window management capabilities.
 	OnWm_capabilities func([]uint32)
 }
 
-func (top *XdgToplevel) Version() int { return top.vers }
+func (top *XdgToplevel) Version() int           { return top.vers }
+func (top *XdgToplevel) ID() uint32             { return proxyID(unsafe.Pointer(top.hnd), top.id) }
+func (top *XdgToplevel) Interface() string      { return "xdg_toplevel" }
+func (top *XdgToplevel) Handle() unsafe.Pointer { return unsafe.Pointer(top.hnd) }
+func (top *XdgToplevel) display() *Display      { return top.dsp }
 
 func (top *XdgToplevel) Destroy() {
-	C.xdg_toplevel_destroy(top.hnd)
+	if top.hnd == nil {
+		top.dsp.destroyedTwice(top)
+		return
+	}
+	top.id = top.ID()
+	if top.dsp.traced(top) {
+		top.dsp.traceRequest(top, "destroy")
+	}
 	top.dsp.forget((*C.struct_wl_proxy)(top.hnd))
+	C.xdg_toplevel_destroy(top.hnd)
+	top.hnd = nil
 }
 
 func (top *XdgToplevel) SetTitle(s string) {
+	checkLive(top)
 	cstr := C.CString(s)
 	defer C.free(unsafe.Pointer(cstr))
 	C.xdg_toplevel_set_title(top.hnd, cstr)
+	if top.dsp.traced(top) {
+		top.dsp.traceRequest(top, "set_title", s)
+	}
 }
 
 type XdgDecorationManager struct {
 	dsp  *Display
 	hnd  *C.struct_zxdg_decoration_manager_v1
+	id   uint32
 	vers int
 }
 
-func (xdg *XdgDecorationManager) Version() int { return xdg.vers }
+func (xdg *XdgDecorationManager) Version() int           { return xdg.vers }
+func (xdg *XdgDecorationManager) ID() uint32             { return proxyID(unsafe.Pointer(xdg.hnd), xdg.id) }
+func (xdg *XdgDecorationManager) Interface() string      { return "zxdg_decoration_manager_v1" }
+func (xdg *XdgDecorationManager) Handle() unsafe.Pointer { return unsafe.Pointer(xdg.hnd) }
+func (xdg *XdgDecorationManager) display() *Display      { return xdg.dsp }
 
 func (xdg *XdgDecorationManager) ToplevelDecoration(top *XdgToplevel) *XdgToplevelDecoration {
+	checkLive(xdg)
+	defer creating(xdg)()
+	checkLive(top)
 	dec := &XdgToplevelDecoration{
 		dsp:  xdg.dsp,
 		hnd:  C.zxdg_decoration_manager_v1_get_toplevel_decoration(xdg.hnd, top.hnd),
 		vers: xdg.vers,
 	}
 	xdg.dsp.add((*C.struct_wl_proxy)(dec.hnd), dec)
+	if xdg.dsp.traced(xdg) {
+		xdg.dsp.traceRequest(xdg, "get_toplevel_decoration", dec, top)
+	}
 	return dec
 }
 
 func (xdg *XdgDecorationManager) Destroy() {
-	C.zxdg_decoration_manager_v1_destroy(xdg.hnd)
+	if xdg.hnd == nil {
+		xdg.dsp.destroyedTwice(xdg)
+		return
+	}
+	xdg.id = xdg.ID()
+	if xdg.dsp.traced(xdg) {
+		xdg.dsp.traceRequest(xdg, "destroy")
+	}
 	xdg.dsp.forget((*C.struct_wl_proxy)(xdg.hnd))
+	C.zxdg_decoration_manager_v1_destroy(xdg.hnd)
+	xdg.hnd = nil
 }
 
 type XdgToplevelDecoration struct {
 	dsp         *Display
 	hnd         *C.struct_zxdg_toplevel_decoration_v1
+	id          uint32
 	vers        int
 	OnConfigure func(mode XdgToplevelDecorationMode)
 }
 
-func (dec *XdgToplevelDecoration) Version() int { return dec.vers }
+func (dec *XdgToplevelDecoration) Version() int           { return dec.vers }
+func (dec *XdgToplevelDecoration) ID() uint32             { return proxyID(unsafe.Pointer(dec.hnd), dec.id) }
+func (dec *XdgToplevelDecoration) Interface() string      { return "zxdg_toplevel_decoration_v1" }
+func (dec *XdgToplevelDecoration) Handle() unsafe.Pointer { return unsafe.Pointer(dec.hnd) }
+func (dec *XdgToplevelDecoration) display() *Display      { return dec.dsp }
 
 func (dec *XdgToplevelDecoration) Destroy() {
-	C.zxdg_toplevel_decoration_v1_destroy(dec.hnd)
+	if dec.hnd == nil {
+		dec.dsp.destroyedTwice(dec)
+		return
+	}
+	dec.id = dec.ID()
+	if dec.dsp.traced(dec) {
+		dec.dsp.traceRequest(dec, "destroy")
+	}
 	dec.dsp.forget((*C.struct_wl_proxy)(dec.hnd))
+	C.zxdg_toplevel_decoration_v1_destroy(dec.hnd)
+	dec.hnd = nil
 }
 
 func (dec *XdgToplevelDecoration) SetMode(mode XdgToplevelDecorationMode) {
+	checkLive(dec)
 	C.zxdg_toplevel_decoration_v1_set_mode(dec.hnd, C.uint32_t(mode))
+	if dec.dsp.traced(dec) {
+		dec.dsp.traceRequest(dec, "set_mode", mode)
+	}
 }
 
 type WpViewporter struct {
 	dsp  *Display
 	hnd  *C.struct_wp_viewporter
+	id   uint32
 	vers int
 }
 
 func (porter *WpViewporter) Viewport(surf *Surface) *WpViewport {
+	checkLive(porter)
+	defer creating(porter)()
+	checkLive(surf)
 	out := &WpViewport{
 		dsp:  porter.dsp,
 		hnd:  C.wp_viewporter_get_viewport(porter.hnd, surf.hnd),
 		vers: porter.vers,
 	}
 	porter.dsp.add((*C.struct_wl_proxy)(out.hnd), out)
+	if porter.dsp.traced(porter) {
+		porter.dsp.traceRequest(porter, "get_viewport", out, surf)
+	}
 	return out
 }
 
+func (porter *WpViewporter) ID() uint32             { return proxyID(unsafe.Pointer(porter.hnd), porter.id) }
+func (porter *WpViewporter) Interface() string      { return "wp_viewporter" }
+func (porter *WpViewporter) Version() int           { return porter.vers }
+func (porter *WpViewporter) Handle() unsafe.Pointer { return unsafe.Pointer(porter.hnd) }
+func (porter *WpViewporter) display() *Display      { return porter.dsp }
+
 func (porter *WpViewporter) Destroy() {
-	C.wp_viewporter_destroy(porter.hnd)
+	if porter.hnd == nil {
+		porter.dsp.destroyedTwice(porter)
+		return
+	}
+	porter.id = porter.ID()
+	if porter.dsp.traced(porter) {
+		porter.dsp.traceRequest(porter, "destroy")
+	}
 	porter.dsp.forget((*C.struct_wl_proxy)(porter.hnd))
+	C.wp_viewporter_destroy(porter.hnd)
+	porter.hnd = nil
 }
 
 type WpViewport struct {
 	dsp  *Display
 	hnd  *C.struct_wp_viewport
+	id   uint32
 	vers int
 }
 
 func (port *WpViewport) SetDestination(width, height int) {
+	checkLive(port)
 	C.wp_viewport_set_destination(port.hnd, C.int32_t(width), C.int32_t(height))
+	if port.dsp.traced(port) {
+		port.dsp.traceRequest(port, "set_destination", width, height)
+	}
+}
+
+// UnsetDestination unsets the destination size, making the surface size depend on the
+// source rectangle or the buffer size.
+func (port *WpViewport) UnsetDestination() {
+	checkLive(port)
+	C.wp_viewport_set_destination(port.hnd, -1, -1)
+	if port.dsp.traced(port) {
+		port.dsp.traceRequest(port, "set_destination", -1, -1)
+	}
 }
 
+// SetSource sets the source rectangle in buffer coordinates, after applying the buffer
+// transform and scale. The values are transmitted as 24.8 fixed-point numbers. The origin
+// must not be negative and the size must be positive, or the server would raise a protocol
+// error. Use UnsetSource to unset the rectangle.
+func (port *WpViewport) SetSource(x, y, width, height float64) error {
+	checkLive(port)
+	if err := checkVersion(port, "set_source", C.WP_VIEWPORT_SET_SOURCE_SINCE_VERSION); err != nil {
+		return err
+	}
+	if !(x >= 0 && y >= 0 && width > 0 && height > 0) {
+		return fmt.Errorf("invalid viewport source rectangle %gx%g%+g%+g", width, height, x, y)
+	}
+	if x+width > maxFixed || y+height > maxFixed {
+		return fmt.Errorf("viewport source rectangle %gx%g%+g%+g out of range", width, height, x, y)
+	}
+	fx, fy, fw, fh := toFixed(x), toFixed(y), toFixed(width), toFixed(height)
+	if fw == 0 || fh == 0 {
+		return fmt.Errorf("viewport source size %gx%g rounds to zero", width, height)
+	}
+	C.wp_viewport_set_source(port.hnd, fx, fy, fw, fh)
+	if port.dsp.traced(port) {
+		port.dsp.traceRequest(port, "set_source", x, y, width, height)
+	}
+	return nil
+}
+
+// maxFixed is the largest value representable by wl_fixed_t.
+const maxFixed = float64(math.MaxInt32) / 256
+
+// toFixed converts f to a 24.8 fixed-point number, rounding to the nearest representable
+// value. f must be in range.
+func toFixed(f float64) C.wl_fixed_t {
+	return C.wl_fixed_t(math.Round(f * 256))
+}
+
+// UnsetSource unsets the source rectangle, making the whole buffer the source.
+func (port *WpViewport) UnsetSource() {
+	checkLive(port)
+	minusOne := C.wl_fixed_t(-256)
+	C.wp_viewport_set_source(port.hnd, minusOne, minusOne, minusOne, minusOne)
+	if port.dsp.traced(port) {
+		port.dsp.traceRequest(port, "set_source", -1.0, -1.0, -1.0, -1.0)
+	}
+}
+
+func (port *WpViewport) ID() uint32             { return proxyID(unsafe.Pointer(port.hnd), port.id) }
+func (port *WpViewport) Interface() string      { return "wp_viewport" }
+func (port *WpViewport) Version() int           { return port.vers }
+func (port *WpViewport) Handle() unsafe.Pointer { return unsafe.Pointer(port.hnd) }
+func (port *WpViewport) display() *Display      { return port.dsp }
+
 func (port *WpViewport) Destroy() {
-	C.wp_viewport_destroy(port.hnd)
+	if port.hnd == nil {
+		port.dsp.destroyedTwice(port)
+		return
+	}
+	port.id = port.ID()
+	if port.dsp.traced(port) {
+		port.dsp.traceRequest(port, "destroy")
+	}
 	port.dsp.forget((*C.struct_wl_proxy)(port.hnd))
+	C.wp_viewport_destroy(port.hnd)
+	port.hnd = nil
 }
 
 type XdgToplevelDecorationMode uint32
@@ -876,9 +2295,36 @@ const (
 	XdgToplevelDecorationModeServerSide = C.ZXDG_TOPLEVEL_DECORATION_V1_MODE_SERVER_SIDE
 )
 
+type WpPresentationFeedbackKind uint32
+
 const (
-	WpPresentationFeedbackKindVsync        = C.WP_PRESENTATION_FEEDBACK_KIND_VSYNC
-	WpPresentationFeedbackKindHWClock      = C.WP_PRESENTATION_FEEDBACK_KIND_HW_CLOCK
-	WpPresentationFeedbackKindHWCompletion = C.WP_PRESENTATION_FEEDBACK_KIND_HW_COMPLETION
-	WpPresentationFeedbackKindZeroCopy     = C.WP_PRESENTATION_FEEDBACK_KIND_ZERO_COPY
+	WpPresentationFeedbackKindVsync        WpPresentationFeedbackKind = C.WP_PRESENTATION_FEEDBACK_KIND_VSYNC
+	WpPresentationFeedbackKindHWClock      WpPresentationFeedbackKind = C.WP_PRESENTATION_FEEDBACK_KIND_HW_CLOCK
+	WpPresentationFeedbackKindHWCompletion WpPresentationFeedbackKind = C.WP_PRESENTATION_FEEDBACK_KIND_HW_COMPLETION
+	WpPresentationFeedbackKindZeroCopy     WpPresentationFeedbackKind = C.WP_PRESENTATION_FEEDBACK_KIND_ZERO_COPY
 )
+
+func (k WpPresentationFeedbackKind) String() string {
+	if k == 0 {
+		return "0"
+	}
+	var names []string
+	for _, f := range [...]struct {
+		kind WpPresentationFeedbackKind
+		name string
+	}{
+		{WpPresentationFeedbackKindVsync, "vsync"},
+		{WpPresentationFeedbackKindHWClock, "hw_clock"},
+		{WpPresentationFeedbackKindHWCompletion, "hw_completion"},
+		{WpPresentationFeedbackKindZeroCopy, "zero_copy"},
+	} {
+		if k&f.kind != 0 {
+			names = append(names, f.name)
+			k &^= f.kind
+		}
+	}
+	if k != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(k)))
+	}
+	return strings.Join(names, "|")
+}
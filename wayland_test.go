@@ -0,0 +1,180 @@
+package wayland
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConcurrentProxies(t *testing.T) {
+	// One goroutine dispatches while others create and destroy proxies. Run with -race.
+	dsp, comp := newTestCompositor(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error)
+	go func() { ran <- dsp.Run(ctx) }()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait := func(ch <-chan struct{}, what string) bool {
+				select {
+				case <-ch:
+					return true
+				case <-time.After(10 * time.Second):
+					t.Errorf("%s didn't complete", what)
+					return false
+				}
+			}
+			for j := range 100 {
+				surf := comp.CreateSurface()
+				called := make(chan struct{})
+				cb := surf.Frame(func(uint32) { close(called) })
+				s := dsp.Sync(nil)
+				if (i+j)%2 == 0 {
+					s.Cancel()
+				} else if !wait(s.Done(), "sync request") {
+					// The reply is lost if it's dispatched before the callback has been
+					// added.
+					return
+				}
+				if !wait(called, "frame callback") {
+					return
+				}
+				// The dispatcher destroys the callback after its handler has returned,
+				// racing with us.
+				cb.Destroy()
+				surf.Destroy()
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	if err := <-ran; err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	roundtrip(t, dsp)
+	live := dsp.LiveProxies()
+	if live["wl_surface"] != 0 || live["wl_callback"] != 0 {
+		t.Errorf("leaked proxies: %v", live)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	if err := connectError("couldn't connect", nil); err.Error() != "couldn't connect" {
+		t.Errorf("got %q for nil errno", err)
+	}
+	err := connectError("couldn't connect", syscall.ENOENT)
+	if !errors.Is(err, syscall.ENOENT) || err.Error() != "couldn't connect: "+syscall.ENOENT.Error() {
+		t.Errorf("got %q, which should wrap ENOENT", err)
+	}
+}
+
+func TestStrictDestroyCallback(t *testing.T) {
+	dsp, surf := newTestSurface(t)
+	dsp.StrictDestroy = true
+	cb := surf.Frame(nil)
+	roundtrip(t, dsp)
+	// Destroying a callback after the dispatcher destroyed it isn't a double destroy.
+	cb.Destroy()
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrDestroyed) {
+			t.Errorf("second Destroy didn't panic with ErrDestroyed, got %v", err)
+		}
+	}()
+	cb.Destroy()
+}
+
+func TestUseAfterDestroy(t *testing.T) {
+	_, dsp := newTestServer(t, nil, testGlobal{1, "wl_compositor", 6}, testGlobal{2, "wp_viewporter", 1})
+	comp := bindGlobal[*Compositor](t, dsp, 1, 6)
+	porter := bindGlobal[*WpViewporter](t, dsp, 2, 1)
+	surf := comp.CreateSurface()
+	port := porter.Viewport(surf)
+	port.Destroy()
+	// A destroyed window, since the EGL library may not be able to create one.
+	win := &EGLWindow{surf: surf}
+
+	for name, use := range map[string]func(){
+		"WpViewport.SetSource":   func() { port.SetSource(0, 0, 1, 1) },
+		"EGLWindow.Resize":       func() { win.Resize(32, 32, 0, 0) },
+		"EGLWindow.AttachedSize": func() { win.AttachedSize() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, ErrDestroyed) {
+					t.Errorf("didn't panic with ErrDestroyed, got %v", err)
+				}
+			}()
+			use()
+		})
+	}
+}
+
+func TestRunRestoresBlocking(t *testing.T) {
+	_, dsp := newTestServer(t, nil)
+	nonblock := func() bool {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, dsp.Fd(), syscall.F_GETFL, 0)
+		if errno != 0 {
+			t.Fatal(errno)
+		}
+		return flags&syscall.O_NONBLOCK != 0
+	}
+	if nonblock() {
+		t.Fatal("display file descriptor is already non-blocking")
+	}
+	if err := dsp.RoundtripTimeout(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if nonblock() {
+		t.Error("display file descriptor is still non-blocking")
+	}
+}
+
+func TestShmFormats(t *testing.T) {
+	s, dsp := newTestServer(t, nil, testGlobal{1, "wl_shm", 1})
+	shm := bindGlobal[*Shm](t, dsp, 1, 1)
+	// The mandatory formats are supported before the server has advertised them.
+	if !shm.Supports(ShmFormatArgb8888) || !shm.Supports(ShmFormatXrgb8888) {
+		t.Error("mandatory formats aren't supported")
+	}
+	if f := shm.Formats(); len(f) != 0 {
+		t.Errorf("got formats %v before any were advertised", f)
+	}
+
+	for _, f := range []ShmFormat{ShmFormatRgb565, ShmFormatXrgb8888, ShmFormatAbgr2101010, ShmFormatArgb8888, ShmFormatRgb565} {
+		s.send(shm.ID(), 0, uint32(f))
+	}
+	roundtrip(t, dsp)
+	want := []ShmFormat{ShmFormatArgb8888, ShmFormatXrgb8888, ShmFormatAbgr2101010, ShmFormatRgb565}
+	if got := shm.Formats(); !slices.Equal(got, want) {
+		t.Errorf("got formats %v, want %v", got, want)
+	}
+	if !shm.Supports(ShmFormatRgb565) || shm.Supports(ShmFormatAbgr8888) {
+		t.Error("Supports doesn't match the advertised formats")
+	}
+
+	for _, tt := range []struct {
+		prefs []ShmFormat
+		want  ShmFormat
+		ok    bool
+	}{
+		// The first supported preference wins, regardless of the order of the formats.
+		{[]ShmFormat{ShmFormatAbgr8888, ShmFormatRgb565, ShmFormatAbgr2101010}, ShmFormatRgb565, true},
+		{[]ShmFormat{ShmFormatAbgr2101010, ShmFormatRgb565}, ShmFormatAbgr2101010, true},
+		{[]ShmFormat{ShmFormatAbgr8888, ShmFormatXrgb8888}, ShmFormatXrgb8888, true},
+		{[]ShmFormat{ShmFormatAbgr8888, ShmFormatRgb888}, 0, false},
+		{nil, 0, false},
+	} {
+		if got, ok := shm.Best(tt.prefs...); got != tt.want || ok != tt.ok {
+			t.Errorf("Best(%v) = %v, %t, want %v, %t", tt.prefs, got, ok, tt.want, tt.ok)
+		}
+	}
+}